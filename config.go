@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultConfigFile is looked up in the working directory when --config is not given
+const DefaultConfigFile = "chat-transformer.json"
+
+// flagAliases maps short and legacy flag names to the canonical name used in config files
+var flagAliases = map[string]string{
+	"i":             "input",
+	"input-folder":  "input",
+	"o":             "output",
+	"output-folder": "output",
+	"v":             "version",
+	"c":             "claude",
+	"gpt":           "chatgpt",
+	"g":             "chatgpt",
+	"md":            "render-markdown",
+}
+
+// nonConfigFlags are command flags that make no sense in a config file
+var nonConfigFlags = map[string]bool{
+	"version":      true,
+	"config":       true,
+	"profile":      true,
+	"print-config": true,
+}
+
+// Config is the content of a config file. Settings use the canonical flag names
+// as keys; a profile's settings are applied on top of the top-level ones.
+type Config struct {
+	Settings map[string]interface{}
+	Profiles map[string]map[string]interface{}
+}
+
+// UnmarshalJSON reads the top-level settings and the "profiles" object
+func (c *Config) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	c.Settings = make(map[string]interface{})
+	for key, value := range raw {
+		if key == "profiles" {
+			if err := json.Unmarshal(value, &c.Profiles); err != nil {
+				return fmt.Errorf("invalid profiles: %w", err)
+			}
+			continue
+		}
+		var setting interface{}
+		if err := json.Unmarshal(value, &setting); err != nil {
+			return err
+		}
+		c.Settings[key] = setting
+	}
+	return nil
+}
+
+// loadConfig reads the config file at path. Without an explicit path the default
+// file in the working directory is used when it exists; the returned path is empty
+// when no config file applies.
+func loadConfig(path string) (*Config, string, error) {
+	if path == "" {
+		if _, err := os.Stat(DefaultConfigFile); err != nil {
+			return nil, "", nil
+		}
+		path = DefaultConfigFile
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, "", fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return &config, path, nil
+}
+
+// applyConfig sets every flag that was not given on the command line from the
+// config file, applying the named profile on top of the top-level settings
+func applyConfig(config *Config, profile string) error {
+	settings := []map[string]interface{}{config.Settings}
+	if profile != "" {
+		profileSettings, ok := config.Profiles[profile]
+		if !ok {
+			return fmt.Errorf("unknown profile %q (available: %s)", profile, strings.Join(profileNames(config), ", "))
+		}
+		settings = append(settings, profileSettings)
+	}
+
+	// Flags given on the command line always win
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[canonicalFlagName(f.Name)] = true
+	})
+
+	for _, values := range settings {
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			name := canonicalFlagName(key)
+			if nonConfigFlags[name] || flag.Lookup(name) == nil {
+				return fmt.Errorf("unknown setting %q", key)
+			}
+			if explicit[name] {
+				continue
+			}
+			if err := flag.Set(name, configValue(values[key])); err != nil {
+				return fmt.Errorf("invalid value for %q: %w", key, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// printEffectiveConfig prints the settings a run would use, in config file format
+func printEffectiveConfig(source, profile string) error {
+	settings := make(map[string]interface{})
+	flag.VisitAll(func(f *flag.Flag) {
+		if _, alias := flagAliases[f.Name]; alias || nonConfigFlags[f.Name] {
+			return
+		}
+		if getter, ok := f.Value.(flag.Getter); ok {
+			settings[f.Name] = getter.Get()
+		} else {
+			settings[f.Name] = f.Value.String()
+		}
+	})
+
+	// Report where the settings came from on stderr so stdout stays valid JSON
+	if source != "" {
+		fmt.Fprintf(os.Stderr, "Config file: %s\n", source)
+	}
+	if profile != "" {
+		fmt.Fprintf(os.Stderr, "Profile: %s\n", profile)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(settings)
+}
+
+// canonicalFlagName resolves a flag alias to its canonical name
+func canonicalFlagName(name string) string {
+	if canonical, ok := flagAliases[name]; ok {
+		return canonical
+	}
+	return name
+}
+
+// configValue formats a JSON value as a flag value
+func configValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		// Lists (e.g. projects) are accepted as comma-separated values
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, fmt.Sprint(item))
+		}
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// profileNames returns the sorted profile names of a config
+func profileNames(config *Config) []string {
+	names := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
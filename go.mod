@@ -1,3 +1,3 @@
-module chat-transformer
+module github.com/oisee/chat-transformer
 
 go 1.21
@@ -0,0 +1,157 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/oisee/chat-transformer/internal/models"
+)
+
+// Columns of the CSV tables
+var (
+	ConversationColumns = []string{"id", "title", "platform", "project", "created_date", "last_modified",
+		"message_count", "participants", "topics", "has_code", "has_media", "file_path"}
+	MessageColumns = []string{"conversation_id", "message_id", "author", "timestamp", "length", "has_code", "content"}
+)
+
+// csvListSeparator joins list values, such as topics, into one cell
+const csvListSeparator = "; "
+
+// csvTables writes a conversations table and a messages table
+type csvTables struct {
+	conversations *csv.Writer
+	messages      *csv.Writer
+	maxContent    int
+	wroteHeader   bool
+}
+
+// NewCSV returns an exporter that writes a row per conversation to conversations
+// and a row per message to messages, each with a header row. Fields are quoted
+// as RFC 4180 requires and rows end in CRLF. Message content longer than
+// maxContent characters is cut off when maxContent is positive; the length
+// column always holds the full length.
+func NewCSV(conversations, messages io.Writer, maxContent int) Exporter {
+	tables := &csvTables{
+		conversations: csv.NewWriter(conversations),
+		messages:      csv.NewWriter(messages),
+		maxContent:    maxContent,
+	}
+	tables.conversations.UseCRLF = true
+	tables.messages.UseCRLF = true
+	return tables
+}
+
+// CSVFiles returns an exporter that writes conversations.csv and messages.csv to dest
+func CSVFiles(dest Destination, maxContent int) (Exporter, error) {
+	if dest.Dir == Stdout {
+		return nil, fmt.Errorf("CSV exports write two files and cannot be written to standard output")
+	}
+
+	conversations, err := dest.Create("conversations.csv")
+	if err != nil {
+		return nil, err
+	}
+	messages, err := dest.Create("messages.csv")
+	if err != nil {
+		conversations.Close()
+		return nil, err
+	}
+	return &withFiles{NewCSV(conversations, messages, maxContent), []*File{conversations, messages}}, nil
+}
+
+// writeHeaders writes the header rows before the first conversation, or at the
+// end when there were none
+func (c *csvTables) writeHeaders() error {
+	if c.wroteHeader {
+		return nil
+	}
+	c.wroteHeader = true
+	if err := c.conversations.Write(ConversationColumns); err != nil {
+		return err
+	}
+	return c.messages.Write(MessageColumns)
+}
+
+func (c *csvTables) Write(conv models.Conversation) error {
+	if err := c.writeHeaders(); err != nil {
+		return err
+	}
+
+	metadata := conv.Metadata
+	err := c.conversations.Write([]string{
+		metadata.ID,
+		metadata.Title,
+		metadata.Platform,
+		metadata.Project,
+		csvTime(metadata.CreatedDate),
+		csvTime(metadata.LastModified),
+		strconv.Itoa(metadata.MessageCount),
+		strings.Join(metadata.Participants, csvListSeparator),
+		strings.Join(metadata.Topics, csvListSeparator),
+		strconv.FormatBool(metadata.HasCode),
+		strconv.FormatBool(metadata.HasMedia),
+		metadata.FilePath,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, message := range conv.Messages {
+		err := c.messages.Write([]string{
+			metadata.ID,
+			message.ID,
+			message.Author,
+			csvTime(message.Timestamp),
+			strconv.Itoa(utf8.RuneCountInString(message.Content)),
+			strconv.FormatBool(strings.Contains(message.Content, "`")), // the converters' rule for has_code
+			truncateRunes(message.Content, c.maxContent),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Surface write errors as they happen instead of at the end
+	if err := c.conversations.Error(); err != nil {
+		return err
+	}
+	return c.messages.Error()
+}
+
+func (c *csvTables) Commit() error {
+	if err := c.writeHeaders(); err != nil {
+		return err
+	}
+	c.conversations.Flush()
+	c.messages.Flush()
+	if err := c.conversations.Error(); err != nil {
+		return err
+	}
+	return c.messages.Error()
+}
+
+func (c *csvTables) Close() error {
+	return nil
+}
+
+// csvTime formats a timestamp for a CSV cell, leaving unknown times empty
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// truncateRunes cuts s to at most max characters; max <= 0 keeps it whole
+func truncateRunes(s string, max int) string {
+	if max <= 0 || utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:max])
+}
@@ -0,0 +1,135 @@
+// Package export writes normalized conversations to single-stream formats, such
+// as one JSON object per line, for loading into other tools.
+package export
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/oisee/chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/utils"
+)
+
+// Stdout is the destination directory that writes to standard output
+const Stdout = "-"
+
+// Export formats
+const (
+	FormatNDJSON    = "ndjson"
+	FormatCSV       = "csv"
+	FormatOpenAI    = "openai"    // OpenAI chat fine-tuning JSONL
+	FormatAnthropic = "anthropic" // Anthropic Messages format JSONL
+)
+
+// Formats lists the supported export formats
+var Formats = []string{FormatNDJSON, FormatCSV, FormatOpenAI, FormatAnthropic}
+
+// Exporter writes conversations in one format. Like utils.AtomicFile, it must be
+// committed once every conversation was written; Close without Commit discards
+// the output where possible.
+type Exporter interface {
+	// Write adds a conversation
+	Write(conv models.Conversation) error
+
+	// Commit completes the output
+	Commit() error
+
+	// Close releases the output, discarding it unless it was committed. It is
+	// safe to defer.
+	Close() error
+}
+
+// Destination is where an exporter's files are created
+type Destination struct {
+	Dir  string // output directory, or Stdout for a single file on standard output
+	Gzip bool   // compress every file and add .gz to its name
+}
+
+// File is an output file of an export. Writes are buffered and, for files on
+// disk, only appear under the file's name once it is committed.
+type File struct {
+	atomic *utils.AtomicFile // nil on standard output
+	gzip   *gzip.Writer
+	buffer *bufio.Writer
+}
+
+// Create starts writing the named file of the destination
+func (d Destination) Create(name string) (*File, error) {
+	var w io.Writer = os.Stdout
+	file := &File{}
+	if d.Dir != Stdout {
+		if d.Gzip {
+			name += ".gz"
+		}
+		atomic, err := utils.CreateAtomic(filepath.Join(d.Dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", name, err)
+		}
+		file.atomic = atomic
+		w = atomic
+	}
+	if d.Gzip {
+		file.gzip = gzip.NewWriter(w)
+		w = file.gzip
+	}
+	file.buffer = bufio.NewWriter(w)
+	return file, nil
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	return f.buffer.Write(p)
+}
+
+// Commit flushes the file and moves it into place
+func (f *File) Commit() error {
+	if err := f.buffer.Flush(); err != nil {
+		return err
+	}
+	if f.gzip != nil {
+		if err := f.gzip.Close(); err != nil {
+			return err
+		}
+	}
+	if f.atomic != nil {
+		return f.atomic.Commit()
+	}
+	return nil
+}
+
+// Close discards the file unless it was committed
+func (f *File) Close() error {
+	if f.atomic != nil {
+		return f.atomic.Close()
+	}
+	return nil
+}
+
+// withFiles commits and closes the files an exporter writes to together with it
+type withFiles struct {
+	Exporter
+	files []*File
+}
+
+func (w *withFiles) Commit() error {
+	if err := w.Exporter.Commit(); err != nil {
+		return err
+	}
+	for _, file := range w.files {
+		if err := file.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *withFiles) Close() error {
+	err := w.Exporter.Close()
+	for _, file := range w.files {
+		file.Close()
+	}
+	return err
+}
@@ -0,0 +1,236 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/oisee/chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/parser"
+)
+
+// API roles of fine-tuning turns
+const (
+	roleSystem    = "system"
+	roleUser      = "user"
+	roleAssistant = "assistant"
+	roleTool      = "tool"
+)
+
+// FineTuneOptions select the turns of fine-tuning examples
+type FineTuneOptions struct {
+	KeepSystem    bool // keep system turns; dropped by default
+	KeepTool      bool // keep tool output; dropped by default (see NewFineTune)
+	MaxTurns      int  // most user, assistant and tool turns per example; 0 for no limit
+	MaxCharacters int  // most characters per example, system turns included; 0 for no limit
+
+	Logger *slog.Logger // receives the summary logged by Commit; nil uses slog.Default()
+}
+
+// apiMessage is a turn in the OpenAI and Anthropic formats
+type apiMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// openAIExample is a line of an OpenAI chat fine-tuning file
+type openAIExample struct {
+	Messages []apiMessage `json:"messages"`
+}
+
+// anthropicExample is a line in the Anthropic Messages format
+type anthropicExample struct {
+	System   string       `json:"system,omitempty"`
+	Messages []apiMessage `json:"messages"`
+}
+
+// fineTune writes a fine-tuning example per conversation
+type fineTune struct {
+	encoder *json.Encoder
+	format  string
+	options FineTuneOptions
+	written int
+	skipped int // conversations without an assistant turn within the limits
+}
+
+// NewFineTune returns an exporter that writes a fine-tuning example per line to
+// w, in the OpenAI chat format (FormatOpenAI) or the Anthropic Messages format
+// (FormatAnthropic). Only the active branch of a conversation is used. Examples
+// end on the last assistant turn within the limits; conversations without one
+// are left out.
+//
+// The exports carry no tool call IDs, which OpenAI tool turns require, so kept
+// tool output is appended to the assistant turn before it in the OpenAI format
+// and passed back in a user turn in the Anthropic format.
+func NewFineTune(w io.Writer, format string, options FineTuneOptions) (Exporter, error) {
+	if format != FormatOpenAI && format != FormatAnthropic {
+		return nil, fmt.Errorf("unknown fine-tuning format %q", format)
+	}
+	return &fineTune{encoder: json.NewEncoder(w), format: format, options: options}, nil
+}
+
+// FineTuneFiles returns an exporter that writes <format>.jsonl to dest
+func FineTuneFiles(dest Destination, format string, options FineTuneOptions) (Exporter, error) {
+	file, err := dest.Create(format + ".jsonl")
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := NewFineTune(file, format, options)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &withFiles{exporter, []*File{file}}, nil
+}
+
+// apiRole maps a normalized author back to the role the chat APIs use, or ""
+// for authors without one
+func apiRole(author string) string {
+	switch strings.ToLower(author) {
+	case "user", "human":
+		return roleUser
+	case "claude", "chatgpt", "assistant":
+		return roleAssistant
+	case "system":
+		return roleSystem
+	case "tool":
+		return roleTool
+	}
+	return ""
+}
+
+// turns returns the messages of the active branch that an example can use
+func (f *fineTune) turns(conv models.Conversation) []apiMessage {
+	var turns []apiMessage
+	for _, message := range conv.Messages {
+		content := strings.TrimSpace(message.Content)
+		if message.Inactive || content == "" || content == parser.EmptyMessage {
+			continue
+		}
+
+		role := apiRole(message.Author)
+		switch {
+		case role == "":
+			continue
+		case role == roleSystem && !f.options.KeepSystem:
+			continue
+		case role == roleTool && !f.options.KeepTool:
+			continue
+		}
+		turns = append(turns, apiMessage{Role: role, Content: content})
+	}
+	return turns
+}
+
+// limit returns the longest prefix of turns within the limits that ends on an
+// assistant turn, or nil when there is none
+func (f *fineTune) limit(turns []apiMessage) []apiMessage {
+	end, count, characters := 0, 0, 0
+	for i, turn := range turns {
+		if turn.Role != roleSystem {
+			count++
+		}
+		characters += utf8.RuneCountInString(turn.Content)
+		if (f.options.MaxTurns > 0 && count > f.options.MaxTurns) ||
+			(f.options.MaxCharacters > 0 && characters > f.options.MaxCharacters) {
+			break
+		}
+		if turn.Role == roleAssistant {
+			end = i + 1
+		}
+	}
+	if end == 0 {
+		return nil
+	}
+	return turns[:end]
+}
+
+func (f *fineTune) Write(conv models.Conversation) error {
+	turns := f.turns(conv)
+
+	var example interface{}
+	if f.format == FormatOpenAI {
+		turns = f.limit(openAITurns(turns))
+		example = openAIExample{Messages: turns}
+	} else {
+		system, messages := anthropicTurns(turns)
+		if system != "" {
+			// The system prompt counts towards the characters of the example
+			messages = append([]apiMessage{{Role: roleSystem, Content: system}}, messages...)
+		}
+		turns = f.limit(messages)
+		if len(turns) > 0 && turns[0].Role == roleSystem {
+			example = anthropicExample{System: turns[0].Content, Messages: turns[1:]}
+		} else {
+			example = anthropicExample{Messages: turns}
+		}
+	}
+
+	if turns == nil {
+		f.skipped++
+		return nil
+	}
+	f.written++
+	return f.encoder.Encode(example)
+}
+
+// openAITurns appends tool output to the assistant turn before it, dropping tool
+// output that does not follow an assistant turn
+func openAITurns(turns []apiMessage) []apiMessage {
+	var messages []apiMessage
+	for _, turn := range turns {
+		if turn.Role != roleTool {
+			messages = append(messages, turn)
+			continue
+		}
+		if last := len(messages) - 1; last >= 0 && messages[last].Role == roleAssistant {
+			messages[last].Content += "\n\n" + turn.Content
+		}
+	}
+	return messages
+}
+
+// anthropicTurns arranges turns for the Messages format: system turns become the
+// system prompt, tool output is passed back in user turns, consecutive turns of
+// the same role are merged and the conversation starts with a user turn
+func anthropicTurns(turns []apiMessage) (string, []apiMessage) {
+	var system []string
+	var messages []apiMessage
+	for _, turn := range turns {
+		role := turn.Role
+		switch role {
+		case roleSystem:
+			system = append(system, turn.Content)
+			continue
+		case roleTool:
+			role = roleUser
+		}
+
+		if len(messages) == 0 && role != roleUser {
+			continue
+		}
+		if last := len(messages) - 1; last >= 0 && messages[last].Role == role {
+			messages[last].Content += "\n\n" + turn.Content
+			continue
+		}
+		messages = append(messages, apiMessage{Role: role, Content: turn.Content})
+	}
+	return strings.Join(system, "\n\n"), messages
+}
+
+func (f *fineTune) Commit() error {
+	logger := f.options.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	// Skipped conversations had no assistant turn within the limits
+	logger.Info("Wrote fine-tuning examples", "format", f.format, "count", f.written, "skipped", f.skipped)
+	return nil
+}
+
+func (f *fineTune) Close() error {
+	return nil
+}
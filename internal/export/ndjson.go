@@ -0,0 +1,82 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/oisee/chat-transformer/internal/models"
+)
+
+// ndjson writes one JSON object per line
+type ndjson struct {
+	conversations *json.Encoder
+	messages      *json.Encoder // nil when messages are kept inside their conversation
+}
+
+// MessageRecord is a line of messages.ndjson: a message with the ID of its
+// conversation and its position in it
+type MessageRecord struct {
+	ConversationID string `json:"conversation_id"`
+	Position       int    `json:"position"`
+	models.Message
+}
+
+// NewNDJSON returns an exporter that writes a conversation per line to
+// conversations. When messages is not nil, conversation lines hold only the
+// metadata and every message is written to messages as a MessageRecord.
+func NewNDJSON(conversations, messages io.Writer) Exporter {
+	exporter := &ndjson{conversations: json.NewEncoder(conversations)}
+	if messages != nil {
+		exporter.messages = json.NewEncoder(messages)
+	}
+	return exporter
+}
+
+// NDJSONFiles returns an exporter that writes conversations.ndjson, and with
+// messages also messages.ndjson, to dest
+func NDJSONFiles(dest Destination, messages bool) (Exporter, error) {
+	if messages && dest.Dir == Stdout {
+		return nil, fmt.Errorf("messages.ndjson cannot be written to standard output")
+	}
+
+	conversations, err := dest.Create("conversations.ndjson")
+	if err != nil {
+		return nil, err
+	}
+	if !messages {
+		return &withFiles{NewNDJSON(conversations, nil), []*File{conversations}}, nil
+	}
+
+	messageFile, err := dest.Create("messages.ndjson")
+	if err != nil {
+		conversations.Close()
+		return nil, err
+	}
+	return &withFiles{NewNDJSON(conversations, messageFile), []*File{conversations, messageFile}}, nil
+}
+
+func (n *ndjson) Write(conv models.Conversation) error {
+	if n.messages == nil {
+		return n.conversations.Encode(conv)
+	}
+
+	if err := n.conversations.Encode(conv.Metadata); err != nil {
+		return err
+	}
+	for i, message := range conv.Messages {
+		record := MessageRecord{ConversationID: conv.Metadata.ID, Position: i, Message: message}
+		if err := n.messages.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *ndjson) Commit() error {
+	return nil
+}
+
+func (n *ndjson) Close() error {
+	return nil
+}
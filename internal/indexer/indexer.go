@@ -1,32 +1,58 @@
 package indexer
 
 import (
+	"bytes"
 	"encoding/json"
-	"os"
+	"fmt"
+	"log/slog"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
-	"chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/sink"
 )
 
 // Indexer handles creation of search and discovery indexes
 type Indexer struct {
-	outputPath    string
+	output        sink.Tree
 	conversations []models.ConversationMetadata
 	topics        map[string][]string // topic -> conversation IDs
 	mutex         sync.RWMutex        // protects conversations and topics maps
+	timestamp     time.Time           // recorded as last_updated instead of the current time when set
+	logger        *slog.Logger
 }
 
-// New creates a new indexer instance
-func New(outputPath string) *Indexer {
+// New creates a new indexer instance writing to output
+func New(output sink.Tree) *Indexer {
 	return &Indexer{
-		outputPath:    outputPath,
+		output:        output,
 		conversations: make([]models.ConversationMetadata, 0),
 		topics:        make(map[string][]string),
+		logger:        slog.Default(),
 	}
 }
 
+// SetLogger sets the logger that receives debug messages
+func (idx *Indexer) SetLogger(logger *slog.Logger) {
+	idx.logger = logger
+}
+
+// SetTimestamp sets the time recorded as last_updated in every index instead of
+// the current time, for reproducible output
+func (idx *Indexer) SetTimestamp(timestamp time.Time) {
+	idx.timestamp = timestamp
+}
+
+// lastUpdated returns the time recorded as last_updated
+func (idx *Indexer) lastUpdated() time.Time {
+	if !idx.timestamp.IsZero() {
+		return idx.timestamp
+	}
+	return time.Now()
+}
+
 // AddConversation adds a conversation to the index
 func (idx *Indexer) AddConversation(metadata models.ConversationMetadata) {
 	idx.mutex.Lock()
@@ -43,36 +69,55 @@ func (idx *Indexer) AddConversation(metadata models.ConversationMetadata) {
 	}
 }
 
+// indexFile is an index file and the data written to it
+type indexFile struct {
+	path string // relative to the output directory
+	data interface{}
+}
+
 // GenerateIndexes generates all index files
 func (idx *Indexer) GenerateIndexes() error {
-	// Generate main conversation index
-	if err := idx.generateConversationIndex(); err != nil {
-		return err
-	}
-
-	// Generate topic index
-	if err := idx.generateTopicIndex(); err != nil {
-		return err
+	for _, file := range idx.indexFiles() {
+		if err := idx.saveIndex(file.data, file.path); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	// Generate unified timeline
-	if err := idx.generateTimeline(); err != nil {
-		return err
+// PlanIndexes returns the size of every index file GenerateIndexes would write,
+// by path relative to the output directory
+func (idx *Indexer) PlanIndexes() map[string]int64 {
+	sizes := make(map[string]int64)
+	for _, file := range idx.indexFiles() {
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err == nil {
+			sizes[file.path] = int64(buf.Len())
+		}
 	}
-
-	return nil
+	return sizes
 }
 
-// generateConversationIndex creates the main conversation index
-func (idx *Indexer) generateConversationIndex() error {
+// indexFiles builds the main conversation indexes, the topic index and the unified timeline
+func (idx *Indexer) indexFiles() []indexFile {
 	idx.mutex.RLock()
 	defer idx.mutex.RUnlock()
-	
+
+	files := idx.conversationIndexes()
+	files = append(files, idx.topicIndex(), idx.timeline())
+	return files
+}
+
+// conversationIndexes builds the main conversation indexes. Callers hold the read lock.
+func (idx *Indexer) conversationIndexes() []indexFile {
 	// Claude index
 	claudeConvs := make([]models.ConversationMetadata, 0)
 	chatgptConvs := make([]models.ConversationMetadata, 0)
 
-	for _, conv := range idx.conversations {
+	sorted := idx.sortedConversations()
+	for _, conv := range sorted {
 		if conv.Platform == "claude" {
 			claudeConvs = append(claudeConvs, conv)
 		} else if conv.Platform == "chatgpt" {
@@ -80,87 +125,89 @@ func (idx *Indexer) generateConversationIndex() error {
 		}
 	}
 
-	// Save Claude index
 	claudeIndex := models.Index{
 		Conversations: claudeConvs,
-		LastUpdated:   time.Now(),
+		LastUpdated:   idx.lastUpdated(),
 	}
-	if err := idx.saveIndex(claudeIndex, "claude/index/conversations_index.json"); err != nil {
-		return err
-	}
-
-	// Save ChatGPT index
 	chatgptIndex := models.Index{
 		Conversations: chatgptConvs,
-		LastUpdated:   time.Now(),
+		LastUpdated:   idx.lastUpdated(),
 	}
-	if err := idx.saveIndex(chatgptIndex, "chatgpt/index/conversations_index.json"); err != nil {
-		return err
+	unifiedIndex := models.Index{
+		Conversations: sorted,
+		LastUpdated:   idx.lastUpdated(),
 	}
 
-	// Save unified index
-	unifiedIndex := models.Index{
-		Conversations: idx.conversations,
-		LastUpdated:   time.Now(),
+	return []indexFile{
+		{"claude/index/conversations_index.json", claudeIndex},
+		{"chatgpt/index/conversations_index.json", chatgptIndex},
+		{"unified/conversations_index.json", unifiedIndex},
 	}
-	return idx.saveIndex(unifiedIndex, "unified/conversations_index.json")
 }
 
-// generateTopicIndex creates topic-based indexes
-func (idx *Indexer) generateTopicIndex() error {
-	idx.mutex.RLock()
-	defer idx.mutex.RUnlock()
-	
+// topicIndex builds the topic-based index. Callers hold the read lock.
+func (idx *Indexer) topicIndex() indexFile {
+	// Conversations are added in whatever order they finish processing
+	topics := make(map[string][]string, len(idx.topics))
+	for topic, ids := range idx.topics {
+		sortedIDs := append([]string(nil), ids...)
+		sort.Strings(sortedIDs)
+		topics[topic] = sortedIDs
+	}
+
 	topicIndex := models.TopicIndex{
-		Topics:      idx.topics,
-		LastUpdated: time.Now(),
+		Topics:      topics,
+		LastUpdated: idx.lastUpdated(),
 	}
 
-	return idx.saveIndex(topicIndex, "unified/topics_index.json")
+	return indexFile{"unified/topics_index.json", topicIndex}
 }
 
-// generateTimeline creates a chronological timeline
-func (idx *Indexer) generateTimeline() error {
-	idx.mutex.RLock()
-	defer idx.mutex.RUnlock()
-	
+// timeline builds the chronological timeline. Callers hold the read lock.
+func (idx *Indexer) timeline() indexFile {
 	// Sort conversations by date
-	sorted := make([]models.ConversationMetadata, len(idx.conversations))
-	copy(sorted, idx.conversations)
-
-	// Simple bubble sort by creation date
-	for i := 0; i < len(sorted)-1; i++ {
-		for j := i + 1; j < len(sorted); j++ {
-			if sorted[i].CreatedDate.After(sorted[j].CreatedDate) {
-				sorted[i], sorted[j] = sorted[j], sorted[i]
-			}
-		}
-	}
+	sorted := idx.sortedConversations()
 
 	timeline := map[string]interface{}{
 		"conversations": sorted,
 		"total_count":   len(sorted),
-		"date_range": map[string]interface{}{
+		"last_updated":  idx.lastUpdated(),
+	}
+
+	// A filtered run may select no conversations at all
+	if len(sorted) > 0 {
+		timeline["date_range"] = map[string]interface{}{
 			"earliest": sorted[0].CreatedDate,
 			"latest":   sorted[len(sorted)-1].CreatedDate,
-		},
-		"last_updated": time.Now(),
+		}
 	}
 
-	return idx.saveIndex(timeline, "unified/timeline.json")
+	return indexFile{"unified/timeline.json", timeline}
 }
 
-// saveIndex saves an index to disk
-func (idx *Indexer) saveIndex(data interface{}, relativePath string) error {
-	fullPath := filepath.Join(idx.outputPath, relativePath)
-	
-	// Ensure directory exists
-	dir := filepath.Dir(fullPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
-	}
+// sortedConversations returns the conversations ordered by creation date, platform
+// and ID, so the indexes do not depend on the order conversations were added in.
+// Callers hold the read lock.
+func (idx *Indexer) sortedConversations() []models.ConversationMetadata {
+	sorted := make([]models.ConversationMetadata, len(idx.conversations))
+	copy(sorted, idx.conversations)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if !a.CreatedDate.Equal(b.CreatedDate) {
+			return a.CreatedDate.Before(b.CreatedDate)
+		}
+		if a.Platform != b.Platform {
+			return a.Platform < b.Platform
+		}
+		return a.ID < b.ID
+	})
+	return sorted
+}
 
-	file, err := os.Create(fullPath)
+// saveIndex saves an index to the output
+func (idx *Indexer) saveIndex(data interface{}, relativePath string) error {
+	file, err := idx.output.Create(filepath.ToSlash(relativePath))
 	if err != nil {
 		return err
 	}
@@ -168,5 +215,13 @@ func (idx *Indexer) saveIndex(data interface{}, relativePath string) error {
 
 	encoder := json.NewEncoder(file)
 	encoder.SetIndent("", "  ")
-	return encoder.Encode(data)
-}
\ No newline at end of file
+	if err := encoder.Encode(data); err != nil {
+		return fmt.Errorf("failed to write index %s: %w", relativePath, err)
+	}
+	if err := file.Commit(); err != nil {
+		return err
+	}
+
+	idx.logger.Debug("wrote index", "path", relativePath)
+	return nil
+}
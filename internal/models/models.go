@@ -26,7 +26,22 @@ type Message struct {
 	Author    string                 `json:"author"`
 	Content   string                 `json:"content"`
 	Timestamp time.Time              `json:"timestamp"`
+	Audio     []AudioClip            `json:"audio,omitempty"`
 	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	Inactive  bool                   `json:"inactive,omitempty"` // on an edited or regenerated branch, not the one the conversation ends on
+}
+
+// AudioClip links a voice-mode audio file to its message and transcript
+type AudioClip struct {
+	FileID     string   `json:"file_id"`
+	Name       string   `json:"name,omitempty"`
+	Path       string   `json:"path,omitempty"` // relative to the output root
+	MessageID  string   `json:"message_id,omitempty"`
+	Direction  string   `json:"direction,omitempty"` // in (user) or out (assistant)
+	Format     string   `json:"format,omitempty"`
+	Transcript string   `json:"transcript,omitempty"`
+	Start      *float64 `json:"start,omitempty"` // offset in seconds
+	End        *float64 `json:"end,omitempty"`   // offset in seconds
 }
 
 // Conversation represents a full conversation
@@ -110,6 +125,7 @@ type ChatGPTMessage struct {
 	UpdateTime float64                `json:"update_time"`
 	Content    ChatGPTContent         `json:"content"`
 	Status     string                 `json:"status"`
+	Recipient  string                 `json:"recipient,omitempty"`
 	Metadata   map[string]interface{} `json:"metadata,omitempty"`
 }
 
@@ -122,8 +138,28 @@ type ChatGPTAuthor struct {
 
 // ChatGPTContent represents the content of a ChatGPT message
 type ChatGPTContent struct {
-	ContentType string   `json:"content_type"`
-	Parts       []string `json:"parts"`
+	ContentType string                   `json:"content_type"`
+	Parts       []string                 `json:"parts"`
+	Text        string                   `json:"text,omitempty"`
+	Assets      []ChatGPTAsset           `json:"assets,omitempty"`
+	Transcripts []ChatGPTAudioTranscript `json:"transcripts,omitempty"`
+}
+
+// ChatGPTAudioTranscript represents an audio_transcription part of a voice message
+type ChatGPTAudioTranscript struct {
+	Text      string `json:"text"`
+	Direction string `json:"direction,omitempty"`
+}
+
+// ChatGPTAsset represents an asset pointer part (image, audio) within a ChatGPT message
+type ChatGPTAsset struct {
+	ContentType  string                 `json:"content_type"`
+	AssetPointer string                 `json:"asset_pointer"`
+	SizeBytes    int64                  `json:"size_bytes,omitempty"`
+	Width        int                    `json:"width,omitempty"`
+	Height       int                    `json:"height,omitempty"`
+	Format       string                 `json:"format,omitempty"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
 }
 
 // ChatGPTConversationRaw represents the raw ChatGPT conversation format
@@ -153,6 +189,7 @@ type ChatGPTMessageRaw struct {
 	UpdateTime float64                `json:"update_time"`
 	Content    ChatGPTContentRaw      `json:"content"`
 	Status     string                 `json:"status"`
+	Recipient  string                 `json:"recipient,omitempty"`
 	Metadata   map[string]interface{} `json:"metadata,omitempty"`
 }
 
@@ -160,6 +197,7 @@ type ChatGPTMessageRaw struct {
 type ChatGPTContentRaw struct {
 	ContentType string      `json:"content_type"`
 	Parts       interface{} `json:"parts"` // Can be []string, []interface{}, or string
+	Text        string      `json:"text,omitempty"` // Used by code and execution output content
 }
 
 // ChatGPTUser represents user information
@@ -181,12 +219,33 @@ type MediaFile struct {
 	Path     string    `json:"path"`
 	Size     int64     `json:"size"`
 	Modified time.Time `json:"modified"`
+	MimeType string    `json:"mime_type,omitempty"` // detected from content
+	Kind     string    `json:"kind,omitempty"`      // image, audio, video, document, other
+	Format   string    `json:"format,omitempty"`    // decoded image format
+	Width    int       `json:"width,omitempty"`
+	Height   int       `json:"height,omitempty"`
+	SHA256   string    `json:"sha256,omitempty"`    // set when stored content-addressed
+	LinkMode string    `json:"link_mode,omitempty"` // media mode actually used when placed in the output
+}
+
+// MediaStoreIndex maps exported media names to objects in the content-addressed media store
+type MediaStoreIndex struct {
+	Objects     map[string]MediaObject `json:"objects"` // sha256 -> stored object
+	Names       map[string]string      `json:"names"`   // media folder/name -> sha256
+	LastUpdated time.Time              `json:"last_updated"`
+}
+
+// MediaObject represents a single stored object in the content-addressed media store
+type MediaObject struct {
+	Path string `json:"path"` // relative to the media directory
+	Size int64  `json:"size"`
 }
 
 // AudioConversation represents an audio conversation
 type AudioConversation struct {
 	ConversationID string      `json:"conversation_id"`
 	AudioFiles     []MediaFile `json:"audio_files"`
+	Clips          []AudioClip `json:"clips,omitempty"`
 }
 
 // ChatGPTMediaInfo represents all media files in a ChatGPT export
@@ -194,6 +253,7 @@ type ChatGPTMediaInfo struct {
 	Images             []MediaFile         `json:"images"`
 	DalleGenerations   []MediaFile         `json:"dalle_generations"`
 	UserUploads        []MediaFile         `json:"user_uploads"`
+	Files              []MediaFile         `json:"files"` // non-image attachments next to conversations.json
 	AudioConversations []AudioConversation `json:"audio_conversations"`
 }
 
@@ -218,11 +278,156 @@ type MediaIndex struct {
 // MediaItem represents a media file reference
 type MediaItem struct {
 	ID             string    `json:"id"`
-	Type           string    `json:"type"` // audio, image
-	OriginalPath   string    `json:"original_path"`
-	NewPath        string    `json:"new_path"`
+	Type              string    `json:"type"` // audio, image, dalle
+	OriginalPath      string    `json:"original_path"`
+	NewPath           string    `json:"new_path"`
+	ConversationID    string    `json:"conversation_id"`
+	ConversationTitle string    `json:"conversation_title,omitempty"`
+	ConversationPath  string    `json:"conversation_path,omitempty"`
+	MessageID         string    `json:"message_id,omitempty"`
+	Prompt            string    `json:"prompt,omitempty"` // for DALL-E images
+	GenID             string    `json:"gen_id,omitempty"` // for DALL-E images
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// DalleGeneration links a DALL-E image asset to the prompt that produced it
+type DalleGeneration struct {
+	FileID         string    `json:"file_id"`
+	GenID          string    `json:"gen_id,omitempty"`
+	Prompt         string    `json:"prompt"`
 	ConversationID string    `json:"conversation_id"`
-	MessageID      string    `json:"message_id,omitempty"`
-	Prompt         string    `json:"prompt,omitempty"` // for DALL-E images
+	MessageID      string    `json:"message_id"`
 	CreatedAt      time.Time `json:"created_at"`
-}
\ No newline at end of file
+}
+
+// Manifest records what earlier runs produced so unchanged conversations can be skipped
+type Manifest struct {
+	ConverterVersion int                      `json:"converter_version"`
+	RendererVersion  int                      `json:"renderer_version"`
+	Settings         string                   `json:"settings"`      // output-affecting options of the run
+	Conversations    map[string]ManifestEntry `json:"conversations"` // conversation ID -> entry
+	LastUpdated      time.Time                `json:"last_updated"`
+}
+
+// ManifestEntry records the source hash and output of one processed conversation
+type ManifestEntry struct {
+	SourceHash  string    `json:"source_hash"`
+	OutputPath  string    `json:"output_path"` // relative to the output directory
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+// Plan describes what a run would write, produced by a dry run
+type Plan struct {
+	GeneratedAt   time.Time     `json:"generated_at"`
+	InputPath     string        `json:"input_path"`
+	OutputPath    string        `json:"output_path"`
+	MediaMode     string        `json:"media_mode"`
+	Conversations PlanCounts    `json:"conversations"`
+	Files         []PlannedFile `json:"files"`
+	Media         []PlannedFile `json:"media"`
+	Totals        PlanTotals    `json:"totals"`
+}
+
+// PlanCounts counts planned conversations per platform, project and month
+type PlanCounts struct {
+	ByPlatform map[string]int `json:"by_platform"`
+	ByProject  map[string]int `json:"by_project"` // platform/project -> count
+	ByMonth    map[string]int `json:"by_month"`   // platform/YYYY-MM -> count
+}
+
+// PlannedFile is a single file a run would write
+type PlannedFile struct {
+	Path   string `json:"path"`             // relative to the output directory
+	Source string `json:"source,omitempty"` // conversation ID or media file
+	Action string `json:"action"`           // create, overwrite, unchanged, collision or deduplicated
+	Bytes  int64  `json:"bytes"`
+	Note   string `json:"note,omitempty"`
+}
+
+// PlanTotals summarizes a plan
+type PlanTotals struct {
+	Conversations int   `json:"conversations"`
+	Create        int   `json:"create"`
+	Overwrite     int   `json:"overwrite"`
+	Unchanged     int   `json:"unchanged"`
+	Collisions    int   `json:"collisions"`
+	MediaFiles    int   `json:"media_files"`
+	MediaBytes    int64 `json:"media_bytes"` // bytes copied; linked media takes no extra space
+	Bytes         int64 `json:"bytes"`       // bytes written in total
+}
+
+// TransformationReport describes a completed run. Reports of different runs can
+// be compared through the tool version and the input fingerprints.
+type TransformationReport struct {
+	Tool            ToolInfo                    `json:"tool"`
+	StartedAt       time.Time                   `json:"transformation_started"`
+	CompletedAt     time.Time                   `json:"transformation_completed"`
+	Duration        string                      `json:"processing_duration"`
+	Phases          []PhaseTiming               `json:"phases"`
+	Statistics      ReportStatistics            `json:"statistics"`
+	Platforms       map[string]ReportStatistics `json:"platforms"`
+	Projects        map[string]int              `json:"projects"` // platform/project -> conversations
+	Inputs          []InputFingerprint          `json:"inputs"`
+	Skipped         []ReportItem                `json:"skipped"`
+	Failed          []ReportItem                `json:"failed"`
+	Warnings        []string                    `json:"warnings"`
+	OutputStructure string                      `json:"output_structure"`
+}
+
+// ToolInfo identifies the build that produced a report
+type ToolInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+}
+
+// PhaseTiming is the duration of one phase of a run
+type PhaseTiming struct {
+	Name     string  `json:"name"`
+	Duration string  `json:"duration"`
+	Seconds  float64 `json:"seconds"`
+}
+
+// ReportStatistics counts what a run processed
+type ReportStatistics struct {
+	Conversations int `json:"conversations_processed"`
+	Messages      int `json:"messages_processed"`
+	MediaFiles    int `json:"media_files_processed"`
+	Projects      int `json:"projects_processed"`
+	Unchanged     int `json:"conversations_unchanged"`
+	Filtered      int `json:"conversations_filtered"`
+	Failed        int `json:"conversations_failed"`
+	Collisions    int `json:"filename_collisions,omitempty"`
+}
+
+// InputFingerprint identifies an export file that was read
+type InputFingerprint struct {
+	Path     string    `json:"path"` // relative to the input directory
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	SHA256   string    `json:"sha256"`
+}
+
+// ReportItem is a conversation, project or file that was skipped or failed
+type ReportItem struct {
+	Kind   string `json:"kind"` // conversation, project, document or media
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// RedactionReport counts the values a run redacted, per rule and per
+// conversation. It never contains the redacted values.
+type RedactionReport struct {
+	GeneratedAt   time.Time              `json:"generated_at"`
+	Rules         []string               `json:"rules"`  // in the order they are applied
+	Totals        map[string]int         `json:"totals"` // rule -> values redacted
+	Conversations []RedactedConversation `json:"conversations"`
+	Projects      []RedactedConversation `json:"projects,omitempty"` // Claude projects, by project ID
+}
+
+// RedactedConversation counts the values redacted in one conversation
+type RedactedConversation struct {
+	ID       string         `json:"id"`
+	Platform string         `json:"platform"`
+	Counts   map[string]int `json:"counts"` // rule -> values redacted
+}
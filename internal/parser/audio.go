@@ -0,0 +1,53 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/oisee/chat-transformer/internal/models"
+)
+
+// extractAudioClips pairs the audio asset pointers of a voice message with its transcripts
+func extractAudioClips(msg *models.ChatGPTMessage) []models.AudioClip {
+	var clips []models.AudioClip
+
+	transcripts := msg.Content.Transcripts
+	for _, asset := range msg.Content.Assets {
+		if asset.ContentType != "audio_asset_pointer" {
+			continue
+		}
+
+		clip := models.AudioClip{
+			FileID:    AssetFileID(asset.AssetPointer),
+			MessageID: msg.ID,
+			Format:    asset.Format,
+			Start:     audioOffset(asset.Metadata, "start", "start_timestamp"),
+			End:       audioOffset(asset.Metadata, "end", "end_timestamp"),
+		}
+
+		// Transcripts and audio pointers appear in the same order within a message
+		index := len(clips)
+		switch {
+		case index < len(transcripts):
+			clip.Transcript = transcripts[index].Text
+			clip.Direction = transcripts[index].Direction
+		case len(transcripts) == 1:
+			clip.Transcript = transcripts[0].Text
+			clip.Direction = transcripts[0].Direction
+		}
+		clip.Transcript = strings.TrimSpace(clip.Transcript)
+
+		clips = append(clips, clip)
+	}
+
+	return clips
+}
+
+// audioOffset reads the first numeric timing field present in the asset metadata
+func audioOffset(metadata map[string]interface{}, keys ...string) *float64 {
+	for _, key := range keys {
+		if value, ok := metadata[key].(float64); ok {
+			return &value
+		}
+	}
+	return nil
+}
@@ -1,45 +1,72 @@
 package parser
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
+	"io/fs"
+	"log/slog"
+	"path"
 	"strings"
-	"sync"
 
-	"chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/pipeline"
 )
 
-const (
-	// Number of parallel workers for conversation processing
-	ConversationWorkers = 25
-)
+// exportDataFiles are the export's own data files, which are not media
+var exportDataFiles = map[string]bool{
+	"conversations.json":        true,
+	"user.json":                 true,
+	"chat.html":                 true,
+	"message_feedback.json":     true,
+	"model_comparisons.json":    true,
+	"shared_conversations.json": true,
+	"sora.json":                 true,
+}
 
 // ChatGPTParser handles parsing of ChatGPT exports with streaming support
 type ChatGPTParser struct {
-	inputPath string
+	input   Input
+	workers int
+	logger  *slog.Logger
 }
 
-// conversationJob represents a conversation to be processed
-type conversationJob struct {
-	rawConv models.ChatGPTConversationRaw
-	index   int
+// convertedChatGPT is a ChatGPT conversation and its standard form
+type convertedChatGPT struct {
+	source models.ChatGPTConversation
+	conv   models.Conversation
 }
 
 // NewChatGPTParser creates a new ChatGPT parser instance
-func NewChatGPTParser(inputPath string) *ChatGPTParser {
+func NewChatGPTParser(input Input) *ChatGPTParser {
 	return &ChatGPTParser{
-		inputPath: inputPath,
+		input:   input,
+		workers: DefaultConversationWorkers,
+		logger:  slog.Default(),
+	}
+}
+
+// SetWorkers sets the number of workers converting conversations in parallel
+func (p *ChatGPTParser) SetWorkers(workers int) {
+	if workers > 0 {
+		p.workers = workers
 	}
 }
 
-// ParseConversations parses ChatGPT conversations.json with streaming support
-func (p *ChatGPTParser) ParseConversations(callback func(models.ChatGPTConversation) error) error {
-	filePath := filepath.Join(p.inputPath, "chat-gpt-2025-06-13", "conversations.json")
+// SetLogger sets the logger that receives progress messages and warnings
+func (p *ChatGPTParser) SetLogger(logger *slog.Logger) {
+	p.logger = logger
+}
+
+// ParseConversations parses ChatGPT conversations.json with streaming support and
+// converts the conversations to the standard format in parallel. The callback is
+// called with each conversation and its standard form one at a time, in export
+// order. It stops early with the context's error when ctx is cancelled.
+func (p *ChatGPTParser) ParseConversations(ctx context.Context, callback func(models.ChatGPTConversation, models.Conversation) error) error {
+	filePath := p.input.Path("chat-gpt-2025-06-13", "conversations.json")
 	
-	file, err := os.Open(filePath)
+	file, err := p.input.Open(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to open ChatGPT conversations file: %w", err)
 	}
@@ -52,20 +79,20 @@ func (p *ChatGPTParser) ParseConversations(callback func(models.ChatGPTConversat
 	}
 	
 	fileSize := fileInfo.Size()
-	fmt.Printf("ChatGPT conversations.json size: %.2f MB\n", float64(fileSize)/(1024*1024))
+	p.logger.Info("Reading ChatGPT conversations.json", "path", filePath, "bytes", fileSize)
 
 	// For very large files (>100MB), use streaming approach
 	if fileSize > 100*1024*1024 {
-		return p.parseConversationsStreaming(file, callback)
+		return p.parseConversationsStreaming(ctx, file, filePath, callback)
 	}
 	
 	// For smaller files, use standard approach
-	return p.parseConversationsStandard(file, callback)
+	return p.parseConversationsStandard(ctx, file, callback)
 }
 
 // parseConversationsStreaming handles large single-line JSON files
-func (p *ChatGPTParser) parseConversationsStreaming(file *os.File, callback func(models.ChatGPTConversation) error) error {
-	fmt.Println("Using streaming parser for large ChatGPT file...")
+func (p *ChatGPTParser) parseConversationsStreaming(ctx context.Context, file io.Reader, filePath string, callback func(models.ChatGPTConversation, models.Conversation) error) error {
+	p.logger.Info("Using streaming parser for large ChatGPT file...", "path", filePath)
 	
 	// Read the entire file content (since it's a single line)
 	content, err := io.ReadAll(file)
@@ -79,14 +106,14 @@ func (p *ChatGPTParser) parseConversationsStreaming(file *os.File, callback func
 		return fmt.Errorf("failed to parse ChatGPT conversations JSON: %w", err)
 	}
 
-	fmt.Printf("Successfully parsed %d ChatGPT conversations\n", len(conversations))
+	p.logger.Info("Parsed ChatGPT conversations", "count", len(conversations))
 
-	// Process conversations in parallel
-	return p.processConversationsParallel(conversations, callback)
+	// Convert conversations in parallel
+	return p.processConversations(ctx, conversations, callback)
 }
 
 // parseConversationsStandard handles normally sized files
-func (p *ChatGPTParser) parseConversationsStandard(file *os.File, callback func(models.ChatGPTConversation) error) error {
+func (p *ChatGPTParser) parseConversationsStandard(ctx context.Context, file io.Reader, callback func(models.ChatGPTConversation, models.Conversation) error) error {
 	data, err := io.ReadAll(file)
 	if err != nil {
 		return fmt.Errorf("failed to read ChatGPT conversations file: %w", err)
@@ -97,136 +124,29 @@ func (p *ChatGPTParser) parseConversationsStandard(file *os.File, callback func(
 		return fmt.Errorf("failed to parse ChatGPT conversations JSON: %w", err)
 	}
 
-	for i, rawConv := range conversations {
-		conv, err := p.convertRawConversation(rawConv)
-		if err != nil {
-			fmt.Printf("Warning: failed to convert conversation %d: %v\n", i, err)
-			continue
-		}
-
-		if err := callback(conv); err != nil {
-			fmt.Printf("Warning: callback failed for ChatGPT conversation %s: %v\n", conv.ID, err)
-		}
-	}
-
-	return nil
+	return p.processConversations(ctx, conversations, callback)
 }
 
-// processConversationsParallel processes conversations using parallel workers
-func (p *ChatGPTParser) processConversationsParallel(conversations []models.ChatGPTConversationRaw, callback func(models.ChatGPTConversation) error) error {
-	totalConversations := len(conversations)
-	if totalConversations == 0 {
-		return nil
-	}
-
-	// Create channels for job distribution and progress tracking
-	jobChan := make(chan conversationJob, 100) // Buffered channel
-	resultChan := make(chan error, totalConversations)
-	progressChan := make(chan int, totalConversations)
-
-	// Determine number of workers
-	numWorkers := ConversationWorkers
-	if totalConversations < numWorkers {
-		numWorkers = totalConversations
-	}
-
-	fmt.Printf("Processing conversations with %d workers...\n", numWorkers)
-
-	// Start workers
-	var wg sync.WaitGroup
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go p.conversationWorker(&wg, jobChan, resultChan, progressChan, callback)
-	}
-
-	// Start progress reporter
-	var progressWg sync.WaitGroup
-	progressWg.Add(1)
-	go p.progressReporter(&progressWg, progressChan, totalConversations)
-
-	// Send jobs to workers
-	for i, rawConv := range conversations {
-		jobChan <- conversationJob{
-			rawConv: rawConv,
-			index:   i,
-		}
-	}
-	close(jobChan)
-
-	// Wait for all workers to complete
-	wg.Wait()
-	close(resultChan)
-	close(progressChan)
-
-	// Wait for progress reporter to finish
-	progressWg.Wait()
-
-	// Count successful and failed conversions
-	successCount := 0
-	var errors []error
-	for err := range resultChan {
+// processConversations converts conversations to the standard format with the
+// shared pipeline and passes them to the callback in export order
+func (p *ChatGPTParser) processConversations(ctx context.Context, conversations []models.ChatGPTConversationRaw, callback func(models.ChatGPTConversation, models.Conversation) error) error {
+	config := pipeline.Config{Label: "ChatGPT conversations", Workers: p.workers, Logger: p.logger}
+	return pipeline.Run(ctx, config, conversations, func(raw models.ChatGPTConversationRaw) (convertedChatGPT, error) {
+		source, err := p.convertRawConversation(raw)
 		if err != nil {
-			errors = append(errors, err)
-		} else {
-			successCount++
-		}
-	}
-
-	fmt.Printf("Successfully processed %d valid conversations\n", successCount)
-	if len(errors) > 0 {
-		fmt.Printf("Warning: %d conversations failed to process\n", len(errors))
-		// Print first few errors as examples
-		for i, err := range errors {
-			if i >= 5 { // Limit to first 5 errors to avoid spam
-				fmt.Printf("... and %d more errors\n", len(errors)-5)
-				break
-			}
-			fmt.Printf("  - %v\n", err)
+			return convertedChatGPT{}, fmt.Errorf("failed to convert conversation %s: %w", raw.ID, err)
 		}
-	}
-
-	return nil
-}
-
-// conversationWorker processes conversation jobs from the job channel
-func (p *ChatGPTParser) conversationWorker(wg *sync.WaitGroup, jobChan <-chan conversationJob, resultChan chan<- error, progressChan chan<- int, callback func(models.ChatGPTConversation) error) {
-	defer wg.Done()
-
-	for job := range jobChan {
-		var err error
-
-		// Convert raw conversation to standard format
-		conv, convErr := p.convertRawConversation(job.rawConv)
-		if convErr != nil {
-			err = fmt.Errorf("failed to convert conversation %d: %w", job.index, convErr)
-		} else {
-			// Warn about empty mappings but don't fail
-			if len(conv.Mapping) == 0 {
-				fmt.Printf("Warning: conversation %s has empty mapping after conversion\n", conv.ID)
-			}
-
-			// Call the callback function
-			if callbackErr := callback(conv); callbackErr != nil {
-				err = fmt.Errorf("callback failed for conversation %s: %w", conv.ID, callbackErr)
-			}
+		// Warn about empty mappings but don't fail
+		if len(source.Mapping) == 0 {
+			p.logger.Warn("conversation has empty mapping after conversion", "conversation_id", source.ID)
 		}
-
-		resultChan <- err
-		progressChan <- 1 // Signal one conversation processed
-	}
-}
-
-// progressReporter reports progress of conversation processing
-func (p *ChatGPTParser) progressReporter(wg *sync.WaitGroup, progressChan <-chan int, total int) {
-	defer wg.Done()
-
-	processed := 0
-	for range progressChan {
-		processed++
-		if processed%100 == 0 || processed == total {
-			fmt.Printf("Processed %d/%d conversations...\n", processed, total)
+		return convertedChatGPT{source: source, conv: convertChatGPT(source, p.logger)}, nil
+	}, func(converted convertedChatGPT) error {
+		if err := callback(converted.source, converted.conv); err != nil {
+			return fmt.Errorf("callback failed for conversation %s: %w", converted.source.ID, err)
 		}
-	}
+		return nil
+	})
 }
 
 // convertRawConversation converts the raw ChatGPT format to our standard format
@@ -261,7 +181,7 @@ func (p *ChatGPTParser) convertRawConversation(raw models.ChatGPTConversationRaw
 			if err != nil {
 				// Log but don't fail - add the node without the message
 				// This preserves the tree structure for navigation
-				fmt.Printf("Warning: failed to convert message in node %s: %v\n", nodeID, err)
+				p.logger.Debug("failed to convert message", "conversation_id", raw.ID, "node", nodeID, "error", err)
 				// Don't continue here - we still want to add the node to preserve tree structure
 				// The node.Message will remain nil
 			} else {
@@ -283,12 +203,14 @@ func (p *ChatGPTParser) convertRawMessage(raw models.ChatGPTMessageRaw) (models.
 		CreateTime: raw.CreateTime,
 		UpdateTime: raw.UpdateTime,
 		Status:     raw.Status,
+		Recipient:  raw.Recipient,
 		Metadata:   raw.Metadata,
 	}
 
 	// Handle flexible content format
 	content := models.ChatGPTContent{
 		ContentType: raw.Content.ContentType,
+		Text:        raw.Content.Text,
 	}
 
 	// Convert parts based on their actual type
@@ -301,7 +223,23 @@ func (p *ChatGPTParser) convertRawMessage(raw models.ChatGPTMessageRaw) (models.
 				content.Parts = append(content.Parts, partVal)
 			case map[string]interface{}:
 				// Handle object content (images, etc.)
-				if str, ok := partVal["text"].(string); ok {
+				if asset, ok := decodeAsset(partVal); ok {
+					content.Assets = append(content.Assets, asset)
+					content.Parts = append(content.Parts, assetPlaceholder(asset))
+				} else if nested, ok := partVal["audio_asset_pointer"].(map[string]interface{}); ok {
+					// Real-time voice parts wrap the audio pointer
+					if asset, ok := decodeAsset(nested); ok {
+						content.Assets = append(content.Assets, asset)
+						content.Parts = append(content.Parts, assetPlaceholder(asset))
+					}
+				} else if str, ok := partVal["text"].(string); ok {
+					if partVal["content_type"] == "audio_transcription" {
+						direction, _ := partVal["direction"].(string)
+						content.Transcripts = append(content.Transcripts, models.ChatGPTAudioTranscript{
+							Text:      str,
+							Direction: direction,
+						})
+					}
 					content.Parts = append(content.Parts, str)
 				} else {
 					// Convert object to string representation
@@ -319,6 +257,11 @@ func (p *ChatGPTParser) convertRawMessage(raw models.ChatGPTMessageRaw) (models.
 	case string:
 		// Handle single string
 		content.Parts = []string{v}
+	case nil:
+		// Code and execution output messages carry their content in text
+		if raw.Content.Text != "" {
+			content.Parts = []string{raw.Content.Text}
+		}
 	default:
 		// Handle unexpected format
 		content.Parts = []string{fmt.Sprintf("%v", v)}
@@ -328,11 +271,38 @@ func (p *ChatGPTParser) convertRawMessage(raw models.ChatGPTMessageRaw) (models.
 	return message, nil
 }
 
+// decodeAsset converts an asset pointer part into a typed asset
+func decodeAsset(part map[string]interface{}) (models.ChatGPTAsset, bool) {
+	var asset models.ChatGPTAsset
+	if _, ok := part["asset_pointer"].(string); !ok {
+		return asset, false
+	}
+
+	data, err := json.Marshal(part)
+	if err != nil {
+		return asset, false
+	}
+	if err := json.Unmarshal(data, &asset); err != nil {
+		return asset, false
+	}
+	return asset, true
+}
+
+// assetPlaceholder returns the text recorded in place of an asset part
+func assetPlaceholder(asset models.ChatGPTAsset) string {
+	switch asset.ContentType {
+	case "image_asset_pointer":
+		return fmt.Sprintf("[Image: %s]", AssetFileID(asset.AssetPointer))
+	case "audio_asset_pointer":
+		return fmt.Sprintf("[Audio: %s]", AssetFileID(asset.AssetPointer))
+	default:
+		return fmt.Sprintf("[Asset: %s]", AssetFileID(asset.AssetPointer))
+	}
+}
+
 // ParseUserInfo parses user.json file
 func (p *ChatGPTParser) ParseUserInfo() (*models.ChatGPTUser, error) {
-	filePath := filepath.Join(p.inputPath, "chat-gpt-2025-06-13", "user.json")
-	
-	file, err := os.Open(filePath)
+	file, err := p.input.Open(p.input.Path("chat-gpt-2025-06-13", "user.json"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open user.json: %w", err)
 	}
@@ -353,43 +323,55 @@ func (p *ChatGPTParser) ParseUserInfo() (*models.ChatGPTUser, error) {
 
 // GetMediaFiles scans for media files in the ChatGPT export
 func (p *ChatGPTParser) GetMediaFiles() (*models.ChatGPTMediaInfo, error) {
-	baseDir := filepath.Join(p.inputPath, "chat-gpt-2025-06-13")
+	baseDir := "chat-gpt-2025-06-13"
 	
 	mediaInfo := &models.ChatGPTMediaInfo{
-		Images:           []models.MediaFile{},
-		DalleGenerations: []models.MediaFile{},
-		UserUploads:      []models.MediaFile{},
+		Images:             []models.MediaFile{},
+		DalleGenerations:   []models.MediaFile{},
+		UserUploads:        []models.MediaFile{},
+		Files:              []models.MediaFile{},
 		AudioConversations: []models.AudioConversation{},
 	}
 
-	// Scan main directory for images
-	err := p.scanDirectoryForImages(baseDir, &mediaInfo.Images)
+	// Scan main directory for attachments, skipping the export's own data files
+	mainFiles, err := p.scanDirectoryForMedia(baseDir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to scan main directory: %w", err)
 	}
+	for _, file := range mainFiles {
+		if exportDataFiles[file.Name] {
+			continue
+		}
+		if file.Kind == "image" {
+			mediaInfo.Images = append(mediaInfo.Images, file)
+		} else {
+			mediaInfo.Files = append(mediaInfo.Files, file)
+		}
+	}
 
 	// Scan dalle-generations
-	dalleDir := filepath.Join(baseDir, "dalle-generations")
-	if _, err := os.Stat(dalleDir); err == nil {
-		err = p.scanDirectoryForImages(dalleDir, &mediaInfo.DalleGenerations)
+	dalleDir := path.Join(baseDir, "dalle-generations")
+	if _, err := fs.Stat(p.input.FS, dalleDir); err == nil {
+		mediaInfo.DalleGenerations, err = p.scanDirectoryForMedia(dalleDir)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan dalle-generations: %w", err)
 		}
 	}
 
 	// Scan user uploads
-	entries, err := os.ReadDir(baseDir)
+	entries, err := fs.ReadDir(p.input.FS, baseDir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read base directory: %w", err)
 	}
 
 	for _, entry := range entries {
 		if entry.IsDir() && strings.HasPrefix(entry.Name(), "user-") {
-			userDir := filepath.Join(baseDir, entry.Name())
-			err = p.scanDirectoryForImages(userDir, &mediaInfo.UserUploads)
+			userDir := path.Join(baseDir, entry.Name())
+			uploads, err := p.scanDirectoryForMedia(userDir)
 			if err != nil {
-				fmt.Printf("Warning: failed to scan user directory %s: %v\n", entry.Name(), err)
+				p.logger.Warn("failed to scan user directory", "path", p.input.Path(userDir), "error", err)
 			}
+			mediaInfo.UserUploads = append(mediaInfo.UserUploads, uploads...)
 		}
 	}
 
@@ -397,11 +379,11 @@ func (p *ChatGPTParser) GetMediaFiles() (*models.ChatGPTMediaInfo, error) {
 	for _, entry := range entries {
 		if entry.IsDir() && len(entry.Name()) > 20 && !strings.HasPrefix(entry.Name(), "user-") && !strings.HasPrefix(entry.Name(), "dalle-") {
 			// Likely a conversation ID directory
-			audioDir := filepath.Join(baseDir, entry.Name(), "audio")
-			if _, err := os.Stat(audioDir); err == nil {
+			audioDir := path.Join(baseDir, entry.Name(), "audio")
+			if _, err := fs.Stat(p.input.FS, audioDir); err == nil {
 				audioConv, err := p.scanAudioDirectory(entry.Name(), audioDir)
 				if err != nil {
-					fmt.Printf("Warning: failed to scan audio directory %s: %v\n", entry.Name(), err)
+					p.logger.Warn("failed to scan audio directory", "conversation_id", entry.Name(), "path", p.input.Path(audioDir), "error", err)
 				} else {
 					mediaInfo.AudioConversations = append(mediaInfo.AudioConversations, *audioConv)
 				}
@@ -412,41 +394,34 @@ func (p *ChatGPTParser) GetMediaFiles() (*models.ChatGPTMediaInfo, error) {
 	return mediaInfo, nil
 }
 
-// scanDirectoryForImages scans a directory for image files
-func (p *ChatGPTParser) scanDirectoryForImages(dir string, images *[]models.MediaFile) error {
-	entries, err := os.ReadDir(dir)
+// scanDirectoryForMedia scans a directory of the input for media files of any
+// type, detecting each file's type from its content
+func (p *ChatGPTParser) scanDirectoryForMedia(dir string) ([]models.MediaFile, error) {
+	entries, err := fs.ReadDir(p.input.FS, dir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	files := []models.MediaFile{}
 	for _, entry := range entries {
 		if entry.IsDir() {
 			continue
 		}
 
-		name := entry.Name()
-		ext := strings.ToLower(filepath.Ext(name))
-		if ext == ".png" || ext == ".jpg" || ext == ".jpeg" || ext == ".webp" {
-			info, err := entry.Info()
-			if err != nil {
-				continue
-			}
-
-			*images = append(*images, models.MediaFile{
-				Name:     name,
-				Path:     filepath.Join(dir, name),
-				Size:     info.Size(),
-				Modified: info.ModTime(),
-			})
+		info, err := entry.Info()
+		if err != nil {
+			continue
 		}
+
+		files = append(files, detectMedia(p.input, p.input.Path(dir, entry.Name()), info))
 	}
 
-	return nil
+	return files, nil
 }
 
-// scanAudioDirectory scans for audio files in a conversation directory
+// scanAudioDirectory scans for audio files in a conversation directory of the input
 func (p *ChatGPTParser) scanAudioDirectory(conversationID, audioDir string) (*models.AudioConversation, error) {
-	entries, err := os.ReadDir(audioDir)
+	entries, err := fs.ReadDir(p.input.FS, audioDir)
 	if err != nil {
 		return nil, err
 	}
@@ -461,22 +436,16 @@ func (p *ChatGPTParser) scanAudioDirectory(conversationID, audioDir string) (*mo
 			continue
 		}
 
-		name := entry.Name()
-		ext := strings.ToLower(filepath.Ext(name))
-		if ext == ".wav" || ext == ".mp3" || ext == ".m4a" {
-			info, err := entry.Info()
-			if err != nil {
-				continue
-			}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
 
-			audioConv.AudioFiles = append(audioConv.AudioFiles, models.MediaFile{
-				Name:     name,
-				Path:     filepath.Join(audioDir, name),
-				Size:     info.Size(),
-				Modified: info.ModTime(),
-			})
+		file := detectMedia(p.input, p.input.Path(audioDir, entry.Name()), info)
+		if file.Kind == "audio" || file.Kind == "video" {
+			audioConv.AudioFiles = append(audioConv.AudioFiles, file)
 		}
 	}
 
 	return audioConv, nil
-}
\ No newline at end of file
+}
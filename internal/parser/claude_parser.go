@@ -0,0 +1,102 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/oisee/chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/pipeline"
+)
+
+// ClaudeParser handles parsing of Claude exports
+type ClaudeParser struct {
+	input   Input
+	workers int
+	logger  *slog.Logger
+}
+
+// convertedClaude is a Claude conversation and its standard form
+type convertedClaude struct {
+	source models.ClaudeConversation
+	conv   models.Conversation
+}
+
+// NewClaudeParser creates a new Claude parser instance
+func NewClaudeParser(input Input) *ClaudeParser {
+	return &ClaudeParser{
+		input:   input,
+		workers: DefaultConversationWorkers,
+		logger:  slog.Default(),
+	}
+}
+
+// SetWorkers sets the number of workers converting conversations in parallel
+func (p *ClaudeParser) SetWorkers(workers int) {
+	if workers > 0 {
+		p.workers = workers
+	}
+}
+
+// SetLogger sets the logger that receives progress messages and warnings
+func (p *ClaudeParser) SetLogger(logger *slog.Logger) {
+	p.logger = logger
+}
+
+// ParseConversations parses Claude conversations.json and converts the
+// conversations to the standard format in parallel, naming their projects from
+// projects (keyed by project UUID). The callback is called with each conversation
+// and its standard form one at a time, in export order. It stops early with the
+// context's error when ctx is cancelled.
+func (p *ClaudeParser) ParseConversations(ctx context.Context, projects map[string]models.ClaudeProject, callback func(models.ClaudeConversation, models.Conversation) error) error {
+	file, err := p.input.Open(p.input.Path("claude-2025-06-13", "conversations.json"))
+	if err != nil {
+		return fmt.Errorf("failed to open Claude conversations file: %w", err)
+	}
+	defer file.Close()
+
+	// Read the entire file into memory
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("failed to read Claude conversations file: %w", err)
+	}
+
+	// Parse JSON array directly
+	var conversations []models.ClaudeConversation
+	if err := json.Unmarshal(data, &conversations); err != nil {
+		return fmt.Errorf("failed to parse Claude conversations JSON: %w", err)
+	}
+
+	config := pipeline.Config{Label: "Claude conversations", Workers: p.workers, Logger: p.logger}
+	return pipeline.Run(ctx, config, conversations, func(claude models.ClaudeConversation) (convertedClaude, error) {
+		return convertedClaude{source: claude, conv: ConvertClaudeToStandard(claude, projects)}, nil
+	}, func(converted convertedClaude) error {
+		if err := callback(converted.source, converted.conv); err != nil {
+			return fmt.Errorf("callback failed for conversation %s: %w", converted.source.UUID, err)
+		}
+		return nil
+	})
+}
+
+// ParseProjects parses Claude projects.json file
+func (p *ClaudeParser) ParseProjects() ([]models.ClaudeProject, error) {
+	file, err := p.input.Open(p.input.Path("claude-2025-06-13", "projects.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Claude projects file: %w", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Claude projects file: %w", err)
+	}
+
+	var projects []models.ClaudeProject
+	if err := json.Unmarshal(data, &projects); err != nil {
+		return nil, fmt.Errorf("failed to parse Claude projects: %w", err)
+	}
+
+	return projects, nil
+}
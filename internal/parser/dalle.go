@@ -0,0 +1,144 @@
+package parser
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oisee/chat-transformer/internal/models"
+)
+
+// AssetFileID extracts the export file ID from an asset pointer
+// (e.g. "file-service://file-abc123" -> "file-abc123")
+func AssetFileID(pointer string) string {
+	if idx := strings.Index(pointer, "://"); idx >= 0 {
+		return pointer[idx+3:]
+	}
+	return pointer
+}
+
+// MatchesAssetFile reports whether an exported file name belongs to the given file ID.
+// Exported media files are named "<file-id>-<suffix>.<ext>" or "<file-id>.<ext>".
+func MatchesAssetFile(name, fileID string) bool {
+	if fileID == "" || !strings.HasPrefix(name, fileID) {
+		return false
+	}
+	rest := strings.TrimPrefix(name, fileID)
+	return rest == "" || rest[0] == '-' || rest == filepath.Ext(name)
+}
+
+// AssetFileIDs returns the file IDs an exported media file name can belong to, as
+// accepted by MatchesAssetFile, shortest first
+func AssetFileIDs(name string) []string {
+	var ids []string
+	for i := 1; i < len(name); i++ {
+		if name[i] == '-' {
+			ids = append(ids, name[:i])
+		}
+	}
+	if ext := filepath.Ext(name); ext != "" {
+		ids = append(ids, strings.TrimSuffix(name, ext))
+	}
+	ids = append(ids, name)
+
+	sort.SliceStable(ids, func(i, j int) bool { return len(ids[i]) < len(ids[j]) })
+	return ids
+}
+
+// ExtractDalleGenerations collects the DALL-E images referenced in a conversation
+// together with the prompt that produced each of them
+func ExtractDalleGenerations(chatgpt models.ChatGPTConversation) []models.DalleGeneration {
+	var generations []models.DalleGeneration
+
+	for _, node := range chatgpt.Mapping {
+		if node.Message == nil {
+			continue
+		}
+		msg := node.Message
+
+		for _, asset := range msg.Content.Assets {
+			if asset.ContentType != "image_asset_pointer" {
+				continue
+			}
+
+			genID, prompt, isDalle := dalleAssetMetadata(asset)
+			if !isDalle && !isDalleTool(msg.Author.Name) {
+				continue
+			}
+
+			// Fall back to the prompt sent in the tool call that requested the image
+			if prompt == "" {
+				prompt = dalleCallPrompt(chatgpt, node.Parent)
+			}
+
+			generations = append(generations, models.DalleGeneration{
+				FileID:         AssetFileID(asset.AssetPointer),
+				GenID:          genID,
+				Prompt:         prompt,
+				ConversationID: chatgpt.ID,
+				MessageID:      msg.ID,
+				CreatedAt:      time.Unix(int64(msg.CreateTime), 0),
+			})
+		}
+	}
+
+	sort.Slice(generations, func(i, j int) bool {
+		if !generations[i].CreatedAt.Equal(generations[j].CreatedAt) {
+			return generations[i].CreatedAt.Before(generations[j].CreatedAt)
+		}
+		return generations[i].FileID < generations[j].FileID
+	})
+
+	return generations
+}
+
+// dalleAssetMetadata reads metadata.dalle from an image asset
+func dalleAssetMetadata(asset models.ChatGPTAsset) (genID, prompt string, ok bool) {
+	dalle, ok := asset.Metadata["dalle"].(map[string]interface{})
+	if !ok {
+		return "", "", false
+	}
+	genID, _ = dalle["gen_id"].(string)
+	prompt, _ = dalle["prompt"].(string)
+	return genID, prompt, true
+}
+
+// dalleCallPrompt finds the prompt of the DALL-E tool call at or above the given node
+func dalleCallPrompt(chatgpt models.ChatGPTConversation, nodeID string) string {
+	visited := make(map[string]bool)
+	for nodeID != "" && !visited[nodeID] {
+		visited[nodeID] = true
+		node, exists := chatgpt.Mapping[nodeID]
+		if !exists {
+			return ""
+		}
+
+		if msg := node.Message; msg != nil && isDalleTool(msg.Recipient) {
+			var call struct {
+				Prompt  string   `json:"prompt"`
+				Prompts []string `json:"prompts"`
+			}
+			if err := json.Unmarshal([]byte(msg.Content.Text), &call); err != nil {
+				return ""
+			}
+			if call.Prompt == "" && len(call.Prompts) > 0 {
+				return call.Prompts[0]
+			}
+			return call.Prompt
+		}
+
+		// Stop once we reach the user turn that started the request
+		if node.Message != nil && node.Message.Author.Role == "user" {
+			return ""
+		}
+		nodeID = node.Parent
+	}
+	return ""
+}
+
+// isDalleTool reports whether a tool name or recipient refers to DALL-E
+func isDalleTool(name string) bool {
+	return strings.HasPrefix(name, "dalle")
+}
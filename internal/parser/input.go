@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Input is the folder holding the claude-* and chat-gpt-* export folders. It is
+// read through FS, so exports can come from a directory, an archive, embedded
+// files or an in-memory tree.
+type Input struct {
+	FS  fs.FS
+	Dir string // the same folder on disk, or "" when FS is not backed by a directory
+}
+
+// DirInput returns the input for a folder on disk
+func DirInput(dir string) Input {
+	return Input{FS: os.DirFS(dir), Dir: dir}
+}
+
+// Path returns the path recorded for a file of the input: a path on disk when
+// the input is a directory, the slash-separated path inside FS otherwise. Paths
+// returned by Path can be opened with Open.
+func (in Input) Path(elem ...string) string {
+	name := path.Join(elem...)
+	if in.Dir == "" {
+		return name
+	}
+	return filepath.Join(in.Dir, filepath.FromSlash(name))
+}
+
+// Name returns the slash-separated path inside FS of a path returned by Path
+func (in Input) Name(p string) string {
+	if in.Dir == "" {
+		return p
+	}
+	rel, err := filepath.Rel(in.Dir, p)
+	if err != nil {
+		return p
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Open opens a file by a path returned by Path. Files are always read through
+// FS; Dir only decides whether they can be linked to.
+func (in Input) Open(p string) (fs.File, error) {
+	return in.FS.Open(in.Name(p))
+}
+
+// OnDisk reports whether the input's files can be linked to
+func (in Input) OnDisk() bool {
+	return in.Dir != ""
+}
@@ -0,0 +1,157 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	_ "image/gif"  // register GIF decoder for image.DecodeConfig
+	_ "image/jpeg" // register JPEG decoder for image.DecodeConfig
+	_ "image/png"  // register PNG decoder for image.DecodeConfig
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/oisee/chat-transformer/internal/models"
+)
+
+// sniffLength is the number of leading bytes used for content sniffing
+const sniffLength = 512
+
+// extensionMimeTypes refines generic sniffing results for formats the
+// standard library cannot tell apart by content (text and zip based formats)
+var extensionMimeTypes = map[string]string{
+	".csv":  "text/csv",
+	".tsv":  "text/tab-separated-values",
+	".md":   "text/markdown",
+	".txt":  "text/plain",
+	".json": "application/json",
+	".m4a":  "audio/mp4",
+	".mp3":  "audio/mpeg",
+	".wav":  "audio/wav",
+	".mov":  "video/quicktime",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+}
+
+// detectMedia builds a MediaFile for a path of the input, detecting its MIME type
+// by magic bytes and, for images, its format and dimensions
+func detectMedia(input Input, path string, info fs.FileInfo) models.MediaFile {
+	media := models.MediaFile{
+		Name:     info.Name(),
+		Path:     path,
+		Size:     info.Size(),
+		Modified: info.ModTime(),
+	}
+
+	file, err := input.Open(path)
+	if err != nil {
+		media.MimeType = mimeFromExtension(info.Name(), "application/octet-stream")
+		media.Kind = mediaKind(media.MimeType)
+		return media
+	}
+	defer file.Close()
+
+	head := make([]byte, sniffLength)
+	n, _ := io.ReadFull(file, head)
+	head = head[:n]
+
+	media.MimeType = sniffMimeType(info.Name(), head)
+	media.Kind = mediaKind(media.MimeType)
+
+	if media.Kind == "image" {
+		// Input files are not necessarily seekable, so decode from the sniffed head onwards
+		if config, format, err := image.DecodeConfig(io.MultiReader(bytes.NewReader(head), file)); err == nil {
+			media.Width = config.Width
+			media.Height = config.Height
+			media.Format = format
+		} else if width, height, ok := webpDimensions(head); ok {
+			media.Width = width
+			media.Height = height
+			media.Format = "webp"
+		}
+	}
+
+	return media
+}
+
+// sniffMimeType detects the MIME type from content, falling back to the file
+// extension when the content only yields a generic type
+func sniffMimeType(name string, head []byte) string {
+	detected := http.DetectContentType(head)
+	base, _, _ := strings.Cut(detected, ";")
+
+	switch base {
+	case "application/octet-stream", "text/plain", "application/zip":
+		return mimeFromExtension(name, base)
+	}
+	return base
+}
+
+// mimeFromExtension looks up a MIME type by file extension
+func mimeFromExtension(name, fallback string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if mimeType, ok := extensionMimeTypes[ext]; ok {
+		return mimeType
+	}
+	if mimeType := mime.TypeByExtension(ext); mimeType != "" {
+		base, _, _ := strings.Cut(mimeType, ";")
+		return base
+	}
+	return fallback
+}
+
+// mediaKind classifies a MIME type as image, audio, video, document or other
+func mediaKind(mimeType string) string {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return "image"
+	case strings.HasPrefix(mimeType, "audio/"):
+		return "audio"
+	case strings.HasPrefix(mimeType, "video/"):
+		return "video"
+	case strings.HasPrefix(mimeType, "text/"),
+		mimeType == "application/pdf",
+		mimeType == "application/json",
+		strings.HasPrefix(mimeType, "application/vnd.openxmlformats"),
+		strings.HasPrefix(mimeType, "application/vnd.ms-"),
+		mimeType == "application/msword":
+		return "document"
+	default:
+		return "other"
+	}
+}
+
+// webpDimensions reads the canvas size from a WebP header, which the standard
+// library has no decoder for
+func webpDimensions(head []byte) (int, int, bool) {
+	if len(head) < 30 || !bytes.Equal(head[0:4], []byte("RIFF")) || !bytes.Equal(head[8:12], []byte("WEBP")) {
+		return 0, 0, false
+	}
+
+	switch string(head[12:16]) {
+	case "VP8X":
+		width := 1 + (int(head[24]) | int(head[25])<<8 | int(head[26])<<16)
+		height := 1 + (int(head[27]) | int(head[28])<<8 | int(head[29])<<16)
+		return width, height, true
+	case "VP8 ":
+		if head[23] != 0x9d || head[24] != 0x01 || head[25] != 0x2a {
+			return 0, 0, false
+		}
+		width := int(binary.LittleEndian.Uint16(head[26:28]) & 0x3fff)
+		height := int(binary.LittleEndian.Uint16(head[28:30]) & 0x3fff)
+		return width, height, true
+	case "VP8L":
+		if head[20] != 0x2f {
+			return 0, 0, false
+		}
+		bits := binary.LittleEndian.Uint32(head[21:25])
+		width := 1 + int(bits&0x3fff)
+		height := 1 + int((bits>>14)&0x3fff)
+		return width, height, true
+	}
+	return 0, 0, false
+}
@@ -1,108 +1,25 @@
 package parser
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
-	"os"
+	"log/slog"
+	"sort"
 	"strings"
 	"time"
 
-	"chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/models"
 )
 
-// Parser handles parsing of large JSON files
-type Parser struct {
-	inputPath string
-}
-
-// New creates a new parser instance
-func New(inputPath string) *Parser {
-	return &Parser{
-		inputPath: inputPath,
-	}
-}
-
-// ParseClaudeConversations parses Claude conversations.json file
-func (p *Parser) ParseClaudeConversations(callback func(models.ClaudeConversation) error) error {
-	file, err := os.Open(p.inputPath + "/claude-2025-06-13/conversations.json")
-	if err != nil {
-		return fmt.Errorf("failed to open Claude conversations file: %w", err)
-	}
-	defer file.Close()
-
-	// Read the entire file into memory
-	data, err := io.ReadAll(file)
-	if err != nil {
-		return fmt.Errorf("failed to read Claude conversations file: %w", err)
-	}
-
-	// Parse JSON array directly
-	var conversations []models.ClaudeConversation
-	if err := json.Unmarshal(data, &conversations); err != nil {
-		return fmt.Errorf("failed to parse Claude conversations JSON: %w", err)
-	}
+// ConverterVersion identifies the conversion logic (ConvertClaudeToStandard,
+// ConvertChatGPTToStandard, extractTopics, ...). Bump it whenever their output
+// changes so incremental runs rebuild every conversation.
+const ConverterVersion = 3
 
-	// Process each conversation
-	for _, conv := range conversations {
-		if err := callback(conv); err != nil {
-			fmt.Printf("Warning: callback failed for Claude conversation %s: %v\n", conv.UUID, err)
-		}
-	}
-
-	return nil
-}
+// EmptyMessage is the content recorded for messages without any text
+const EmptyMessage = "[Empty message]"
 
-// ParseClaudeProjects parses Claude projects.json file
-func (p *Parser) ParseClaudeProjects() ([]models.ClaudeProject, error) {
-	file, err := os.Open(p.inputPath + "/claude-2025-06-13/projects.json")
-	if err != nil {
-		return nil, fmt.Errorf("failed to open Claude projects file: %w", err)
-	}
-	defer file.Close()
-
-	data, err := io.ReadAll(file)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read Claude projects file: %w", err)
-	}
-
-	var projects []models.ClaudeProject
-	if err := json.Unmarshal(data, &projects); err != nil {
-		return nil, fmt.Errorf("failed to parse Claude projects: %w", err)
-	}
-
-	return projects, nil
-}
-
-// ParseChatGPTConversations parses ChatGPT conversations.json file
-func (p *Parser) ParseChatGPTConversations(callback func(models.ChatGPTConversation) error) error {
-	file, err := os.Open(p.inputPath + "/chat-gpt-2025-06-13/conversations.json")
-	if err != nil {
-		return fmt.Errorf("failed to open ChatGPT conversations file: %w", err)
-	}
-	defer file.Close()
-
-	// Read the entire file into memory
-	data, err := io.ReadAll(file)
-	if err != nil {
-		return fmt.Errorf("failed to read ChatGPT conversations file: %w", err)
-	}
-
-	// Parse JSON array directly
-	var conversations []models.ChatGPTConversation
-	if err := json.Unmarshal(data, &conversations); err != nil {
-		return fmt.Errorf("failed to parse ChatGPT conversations JSON: %w", err)
-	}
-
-	// Process each conversation
-	for _, conv := range conversations {
-		if err := callback(conv); err != nil {
-			fmt.Printf("Warning: callback failed for ChatGPT conversation %s: %v\n", conv.ID, err)
-		}
-	}
-
-	return nil
-}
+// DefaultConversationWorkers is the number of workers converting conversations in parallel
+const DefaultConversationWorkers = 25
 
 // ConvertClaudeToStandard converts Claude conversation to standard format
 func ConvertClaudeToStandard(claude models.ClaudeConversation, projects map[string]models.ClaudeProject) models.Conversation {
@@ -159,11 +76,12 @@ func ConvertClaudeToStandard(claude models.ClaudeConversation, projects map[stri
 		})
 	}
 
-	// Convert participants map to slice
+	// Convert participants map to slice, sorted so output does not depend on map order
 	var partList []string
 	for p := range participants {
 		partList = append(partList, p)
 	}
+	sort.Strings(partList)
 
 	metadata := models.ConversationMetadata{
 		ID:           claude.UUID,
@@ -185,22 +103,35 @@ func ConvertClaudeToStandard(claude models.ClaudeConversation, projects map[stri
 	}
 }
 
-// ConvertChatGPTToStandard converts ChatGPT conversation to standard format
-func ConvertChatGPTToStandard(chatgpt models.ChatGPTConversation) models.Conversation {
-	// Debug the specific problematic conversation
-	if chatgpt.ID == "68490016-358c-800c-a8e7-a0965ab83993" {
-		fmt.Printf("DEBUG: Converting target conversation %s\n", chatgpt.ID)
-		fmt.Printf("  Title: %s\n", chatgpt.Title)
-		fmt.Printf("  Mapping size: %d\n", len(chatgpt.Mapping))
-		fmt.Printf("  Current node: %s\n", chatgpt.CurrentNode)
-		
-		// Debug node structure
-		for nodeID, node := range chatgpt.Mapping {
-			hasMessage := node.Message != nil
-			fmt.Printf("  Node %s: parent=%s, children=%v, hasMessage=%v\n", 
-				nodeID, node.Parent, node.Children, hasMessage)
+// activeBranch returns the nodes on the path from the conversation's current node
+// to the root, or nil when the current node is unknown
+func activeBranch(chatgpt models.ChatGPTConversation) map[string]bool {
+	if _, exists := chatgpt.Mapping[chatgpt.CurrentNode]; !exists {
+		return nil
+	}
+
+	active := make(map[string]bool)
+	for nodeID := chatgpt.CurrentNode; nodeID != "" && !active[nodeID]; {
+		node, exists := chatgpt.Mapping[nodeID]
+		if !exists {
+			break
 		}
+		active[nodeID] = true
+		nodeID = node.Parent
 	}
+	return active
+}
+
+// ConvertChatGPTToStandard converts ChatGPT conversation to standard format
+func ConvertChatGPTToStandard(chatgpt models.ChatGPTConversation) models.Conversation {
+	return convertChatGPT(chatgpt, slog.Default())
+}
+
+// convertChatGPT converts a ChatGPT conversation, logging problems with its tree to logger
+func convertChatGPT(chatgpt models.ChatGPTConversation, logger *slog.Logger) models.Conversation {
+	logger.Debug("converting ChatGPT conversation", "conversation_id", chatgpt.ID,
+		"nodes", len(chatgpt.Mapping), "current_node", chatgpt.CurrentNode)
+
 	createdAt := time.Unix(int64(chatgpt.CreateTime), 0)
 	updatedAt := time.Unix(int64(chatgpt.UpdateTime), 0)
 
@@ -210,6 +141,9 @@ func ConvertChatGPTToStandard(chatgpt models.ChatGPTConversation) models.Convers
 	hasCode := false
 	hasMedia := false
 
+	// Messages off the path from the current node to the root were edited or regenerated
+	activeNodes := activeBranch(chatgpt)
+
 	// Build message chain from the tree structure
 	visitedNodes := make(map[string]bool)
 	var extractMessages func(nodeID string)
@@ -246,10 +180,14 @@ func ConvertChatGPTToStandard(chatgpt models.ChatGPTConversation) models.Convers
 		}
 		
 		contentText := strings.TrimSpace(content.String())
+
+		if len(msg.Content.Assets) > 0 {
+			hasMedia = true
+		}
 		
 		// If content is empty, still record the message for completeness
 		if contentText == "" {
-			contentText = "[Empty message]"
+			contentText = EmptyMessage
 		}
 
 		if strings.Contains(contentText, "```") || strings.Contains(contentText, "`") {
@@ -269,14 +207,23 @@ func ConvertChatGPTToStandard(chatgpt models.ChatGPTConversation) models.Convers
 			Author:    author,
 			Content:   contentText,
 			Timestamp: msgTime,
+			Audio:     extractAudioClips(msg),
 			Metadata:  msg.Metadata,
+			Inactive:  activeNodes != nil && !activeNodes[nodeID],
 		})
 	}
 
+	// Visit nodes in ID order so messages with equal timestamps keep a stable order
+	nodeIDs := make([]string, 0, len(chatgpt.Mapping))
+	for nodeID := range chatgpt.Mapping {
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+	sort.Strings(nodeIDs)
+
 	// Start from root nodes (nodes with no parent)
 	rootNodes := 0
-	for nodeID, node := range chatgpt.Mapping {
-		if node.Parent == "" {
+	for _, nodeID := range nodeIDs {
+		if chatgpt.Mapping[nodeID].Parent == "" {
 			extractMessages(nodeID)
 			rootNodes++
 		}
@@ -284,14 +231,14 @@ func ConvertChatGPTToStandard(chatgpt models.ChatGPTConversation) models.Convers
 	
 	// If no root nodes found, try starting from current_node or any node with a message
 	if rootNodes == 0 {
-		fmt.Printf("Warning: No root nodes found in conversation %s, trying current_node: %s\n", chatgpt.ID, chatgpt.CurrentNode)
+		logger.Warn("no root nodes found, trying current_node", "conversation_id", chatgpt.ID, "current_node", chatgpt.CurrentNode)
 		if chatgpt.CurrentNode != "" {
 			extractMessages(chatgpt.CurrentNode)
 		} else {
 			// Last resort: try any node with a message
-			fmt.Printf("Warning: No current_node in conversation %s, trying any node with a message\n", chatgpt.ID)
-			for nodeID, node := range chatgpt.Mapping {
-				if node.Message != nil && !visitedNodes[nodeID] {
+			logger.Warn("no current_node, trying any node with a message", "conversation_id", chatgpt.ID)
+			for _, nodeID := range nodeIDs {
+				if chatgpt.Mapping[nodeID].Message != nil && !visitedNodes[nodeID] {
 					extractMessages(nodeID)
 					break
 				}
@@ -308,16 +255,14 @@ func ConvertChatGPTToStandard(chatgpt models.ChatGPTConversation) models.Convers
 		}
 	}
 
-	// Debug output for the target conversation
-	if chatgpt.ID == "68490016-358c-800c-a8e7-a0965ab83993" {
-		fmt.Printf("DEBUG: Extracted %d messages from target conversation\n", len(messages))
-	}
+	logger.Debug("extracted messages", "conversation_id", chatgpt.ID, "messages", len(messages))
 
-	// Convert participants map to slice
+	// Convert participants map to slice, sorted so output does not depend on map order
 	var partList []string
 	for p := range participants {
 		partList = append(partList, p)
 	}
+	sort.Strings(partList)
 
 	metadata := models.ConversationMetadata{
 		ID:           chatgpt.ID,
@@ -367,4 +312,4 @@ func extractTopics(title string) []string {
 	}
 	
 	return topics
-}
\ No newline at end of file
+}
@@ -0,0 +1,152 @@
+// Package pipeline runs the conversion stage shared by the platform parsers:
+// a pool of workers converts exported items while a single goroutine hands the
+// results on in export order.
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// Config configures a pipeline run
+type Config struct {
+	Label   string       // what is processed, for progress messages, e.g. "ChatGPT conversations"
+	Workers int          // maximum number of items converted at once
+	Logger  *slog.Logger // receives progress and failures; nil uses slog.Default()
+}
+
+// job is an item to be converted and its position in the input
+type job[In any] struct {
+	index int
+	item  In
+}
+
+// result is a converted item and its position in the input
+type result[Out any] struct {
+	index int
+	value Out
+	err   error
+}
+
+// Run converts items with a pool of workers and passes the results to deliver in
+// input order, one at a time, so deliver needs no synchronization and identical
+// input is delivered in an identical order. Items that fail to convert or deliver
+// are reported together at the end instead of stopping the run. When ctx is
+// cancelled no new items are started; the deliver call in flight finishes before
+// the context's error is returned.
+func Run[In, Out any](ctx context.Context, config Config, items []In, convert func(In) (Out, error), deliver func(Out) error) error {
+	total := len(items)
+	if total == 0 {
+		return nil
+	}
+
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	numWorkers := config.Workers
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+	if total < numWorkers {
+		numWorkers = total
+	}
+
+	logger.Info("Starting workers", "kind", config.Label, "workers", numWorkers)
+
+	jobChan := make(chan job[In])
+	resultChan := make(chan result[Out], numWorkers)
+
+	// Start workers
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go worker(ctx, &wg, convert, jobChan, resultChan)
+	}
+
+	// Send jobs to workers until cancelled
+	go func() {
+		defer close(jobChan)
+		for i, item := range items {
+			select {
+			case jobChan <- job[In]{index: i, item: item}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(resultChan)
+	}()
+
+	// Collect results and hand them on in input order
+	pending := make(map[int]result[Out])
+	next, successCount := 0, 0
+	var errors []error
+	for res := range resultChan {
+		pending[res.index] = res
+		for {
+			ready, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+
+			if ready.err == nil && ctx.Err() == nil {
+				ready.err = deliver(ready.value)
+			}
+			if ready.err != nil {
+				errors = append(errors, ready.err)
+			} else {
+				successCount++
+			}
+
+			if next%100 == 0 || next == total {
+				logger.Info("Progress", "kind", config.Label, "done", next, "total", total)
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	logger.Info("Finished processing", "kind", config.Label, "count", successCount)
+	if len(errors) > 0 {
+		logger.Warn("failed to process items", "kind", config.Label, "count", len(errors))
+		// Show the first few errors as examples; the rest only at debug level to avoid spam
+		for i, err := range errors {
+			if i < 5 {
+				logger.Warn("item failed", "error", err)
+			} else {
+				logger.Debug("item failed", "error", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// worker converts the items of the job channel
+func worker[In, Out any](ctx context.Context, wg *sync.WaitGroup, convert func(In) (Out, error), jobChan <-chan job[In], resultChan chan<- result[Out]) {
+	defer wg.Done()
+
+	for j := range jobChan {
+		// Drain queued jobs without starting them once cancelled
+		if ctx.Err() != nil {
+			continue
+		}
+
+		res := result[Out]{index: j.index}
+		res.value, res.err = convert(j.item)
+		if res.err != nil {
+			res.err = fmt.Errorf("item %d: %w", j.index, res.err)
+		}
+		resultChan <- res
+	}
+}
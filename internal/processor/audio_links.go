@@ -0,0 +1,66 @@
+package processor
+
+import (
+	"path/filepath"
+
+	"github.com/oisee/chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/parser"
+)
+
+// linkAudioClips resolves the audio clips of a conversation's messages to exported audio files
+func (p *Processor) linkAudioClips(conv *models.Conversation, mediaInfo *models.ChatGPTMediaInfo) {
+	var audioConv *models.AudioConversation
+	for i := range mediaInfo.AudioConversations {
+		if mediaInfo.AudioConversations[i].ConversationID == conv.Metadata.ID {
+			audioConv = &mediaInfo.AudioConversations[i]
+			break
+		}
+	}
+
+	var linked []models.AudioClip
+	for i := range conv.Messages {
+		for j := range conv.Messages[i].Audio {
+			clip := &conv.Messages[i].Audio[j]
+			conv.Metadata.HasMedia = true
+
+			if audioConv == nil {
+				continue
+			}
+			for _, file := range audioConv.AudioFiles {
+				if parser.MatchesAssetFile(file.Name, clip.FileID) {
+					clip.Name = file.Name
+					clip.Path = p.mediaReferencePath(file, filepath.Join("audio-conversations", audioConv.ConversationID))
+					break
+				}
+			}
+			linked = append(linked, *clip)
+		}
+	}
+
+	if len(linked) == 0 {
+		return
+	}
+
+	p.mediaMutex.Lock()
+	defer p.mediaMutex.Unlock()
+	p.audioClips[conv.Metadata.ID] = linked
+}
+
+// audioClipsOf returns the audio clips of all messages in a conversation
+func audioClipsOf(conv models.Conversation) []models.AudioClip {
+	var clips []models.AudioClip
+	for _, msg := range conv.Messages {
+		clips = append(clips, msg.Audio...)
+	}
+	return clips
+}
+
+// attachAudioClips adds the linked clips to each audio conversation of the media info
+func (p *Processor) attachAudioClips(mediaInfo *models.ChatGPTMediaInfo) {
+	p.mediaMutex.Lock()
+	defer p.mediaMutex.Unlock()
+
+	for i, audioConv := range mediaInfo.AudioConversations {
+		mediaInfo.AudioConversations[i].Clips = p.audioClips[audioConv.ConversationID]
+	}
+}
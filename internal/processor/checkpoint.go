@@ -0,0 +1,125 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/oisee/chat-transformer/internal/models"
+)
+
+const (
+	// checkpointFile records the conversations completed by a run that has not
+	// finished yet. It has the format of the manifest and is removed on success.
+	checkpointFile = "processing_checkpoint.json"
+
+	// Minimum time between checkpoint saves; each save writes every completed conversation
+	checkpointInterval = 5 * time.Second
+)
+
+// loadCheckpoint continues from the checkpoint of an interrupted run when resuming:
+// conversations it records as written are skipped like unchanged conversations
+func (p *Processor) loadCheckpoint() {
+	checkpointPath := filepath.Join(p.outputPath, checkpointFile)
+	if !p.resume {
+		if p.outputExists(checkpointFile) {
+			p.logger.Info("Found the checkpoint of an interrupted run, use --resume to continue it", "path", checkpointPath)
+		}
+		return
+	}
+
+	if p.redactor != nil {
+		p.logger.Info("Placeholders are numbered per run, so redacting runs cannot resume; processing all conversations")
+		return
+	}
+
+	data, err := p.readOutput(checkpointFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		p.logger.Info("No checkpoint to resume from, processing all conversations")
+		return
+	}
+	if err != nil {
+		p.logger.Warn("failed to read checkpoint, processing all conversations", "path", checkpointPath, "error", err)
+		return
+	}
+
+	var checkpoint models.Manifest
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		p.logger.Warn("failed to parse checkpoint, processing all conversations", "path", checkpointPath, "error", err)
+		return
+	}
+
+	if checkpoint.ConverterVersion != p.manifest.ConverterVersion ||
+		checkpoint.RendererVersion != p.manifest.RendererVersion ||
+		checkpoint.Settings != p.manifest.Settings {
+		p.logger.Warn("checkpoint was written with other settings, processing all conversations", "path", checkpointPath)
+		return
+	}
+
+	if checkpoint.Conversations != nil {
+		p.setManifestConversations(checkpoint.Conversations)
+	}
+	p.incremental = true
+	p.renderer.SetIncremental(true)
+	p.logger.Info("Resuming from checkpoint", "completed", len(p.manifest.Conversations))
+}
+
+// checkpointConversation saves the checkpoint after a conversation was written
+// when checkpointInterval has passed since the last save. Callers hold manifestMutex.
+func (p *Processor) checkpointConversation() {
+	if p.lastCheckpoint.IsZero() {
+		p.lastCheckpoint = time.Now()
+	}
+	if time.Since(p.lastCheckpoint) < checkpointInterval {
+		return
+	}
+	if err := p.writeCheckpoint(); err != nil {
+		p.logger.Warn("failed to save checkpoint", "error", err)
+	}
+}
+
+// saveCheckpoint writes the conversations completed so far
+func (p *Processor) saveCheckpoint() error {
+	p.manifestMutex.Lock()
+	defer p.manifestMutex.Unlock()
+	return p.writeCheckpoint()
+}
+
+// writeCheckpoint writes the checkpoint. Callers hold manifestMutex.
+func (p *Processor) writeCheckpoint() error {
+	p.lastCheckpoint = time.Now()
+	p.manifest.LastUpdated = p.now()
+
+	file, err := p.createOutput(checkpointFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(p.manifest); err != nil {
+		return err
+	}
+	return file.Commit()
+}
+
+// removeCheckpoint deletes the checkpoint once a run has completed
+func (p *Processor) removeCheckpoint() {
+	if err := p.removeOutput(checkpointFile); err != nil {
+		p.logger.Warn("failed to remove checkpoint", "error", err)
+	}
+}
+
+// interrupted saves the checkpoint of a run that stopped early
+func (p *Processor) interrupted(cause error) error {
+	if err := p.saveCheckpoint(); err != nil {
+		p.logger.Warn("failed to save checkpoint", "error", err)
+	} else {
+		p.logger.Info("Saved checkpoint, run again with --resume to continue")
+	}
+	return fmt.Errorf("transformation interrupted: %w", cause)
+}
@@ -0,0 +1,209 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oisee/chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/parser"
+	"github.com/oisee/chat-transformer/internal/redact"
+)
+
+// dalleRecord is a DALL-E generation together with the conversation it came from
+type dalleRecord struct {
+	generation models.DalleGeneration
+	title      string
+	filePath   string
+}
+
+// recordDalleGenerations remembers the DALL-E generations of a processed conversation
+func (p *Processor) recordDalleGenerations(chatgpt models.ChatGPTConversation, metadata models.ConversationMetadata) {
+	generations := parser.ExtractDalleGenerations(chatgpt)
+	if len(generations) == 0 {
+		return
+	}
+
+	p.mediaMutex.Lock()
+	defer p.mediaMutex.Unlock()
+
+	for _, gen := range generations {
+		if p.redactor != nil {
+			// The values are counted with the conversation, which holds the same prompt
+			gen.Prompt = p.redactor.Text(gen.Prompt, make(redact.Counts))
+		}
+		p.dalleGenerations = append(p.dalleGenerations, dalleRecord{
+			generation: gen,
+			title:      metadata.Title,
+			filePath:   metadata.FilePath,
+		})
+	}
+}
+
+// generateDalleCatalog writes the prompt catalog as JSON and markdown
+func (p *Processor) generateDalleCatalog(mediaInfo *models.ChatGPTMediaInfo) error {
+	catalog, matched := p.dalleCatalog(mediaInfo)
+	if len(catalog.Media) == 0 {
+		return nil
+	}
+
+	mediaDir := filepath.Join("chatgpt", "media")
+	if err := p.saveDalleCatalog(catalog, filepath.Join(mediaDir, "dalle_catalog.json")); err != nil {
+		return err
+	}
+	if err := p.saveDalleCatalogMarkdown(catalog, filepath.Join(mediaDir, "dalle_catalog.md")); err != nil {
+		return err
+	}
+
+	p.logger.Info("Cataloged DALL-E prompts", "count", len(catalog.Media), "matched", matched)
+	return nil
+}
+
+// dalleCatalog matches recorded DALL-E generations to exported image files,
+// returning the catalog and the number of generations matched
+func (p *Processor) dalleCatalog(mediaInfo *models.ChatGPTMediaInfo) (models.MediaIndex, int) {
+	p.mediaMutex.Lock()
+	records := make([]dalleRecord, len(p.dalleGenerations))
+	copy(records, p.dalleGenerations)
+	p.mediaMutex.Unlock()
+
+	// Group generations by conversation so each conversation forms one section:
+	// conversations in the order of their first generation, generations
+	// chronologically within each
+	first := make(map[string]time.Time)
+	for _, record := range records {
+		gen := record.generation
+		if t, ok := first[gen.ConversationID]; !ok || gen.CreatedAt.Before(t) {
+			first[gen.ConversationID] = gen.CreatedAt
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := records[i].generation, records[j].generation
+		if a.ConversationID != b.ConversationID {
+			if !first[a.ConversationID].Equal(first[b.ConversationID]) {
+				return first[a.ConversationID].Before(first[b.ConversationID])
+			}
+			return a.ConversationID < b.ConversationID
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+
+	items := make([]models.MediaItem, 0, len(records))
+	matched := 0
+	for _, record := range records {
+		gen := record.generation
+		item := models.MediaItem{
+			ID:                gen.FileID,
+			Type:              "dalle",
+			ConversationID:    gen.ConversationID,
+			ConversationTitle: record.title,
+			ConversationPath:  record.filePath,
+			MessageID:         gen.MessageID,
+			Prompt:            gen.Prompt,
+			GenID:             gen.GenID,
+			CreatedAt:         gen.CreatedAt,
+		}
+
+		if file, folder, ok := findDalleFile(mediaInfo, gen.FileID); ok {
+			item.OriginalPath = p.getRelativeMediaPath(file.Path)
+			item.NewPath = p.mediaReferencePath(file, folder)
+			matched++
+		}
+
+		items = append(items, item)
+	}
+
+	catalog := models.MediaIndex{
+		Media:       items,
+		LastUpdated: p.now(),
+	}
+	return catalog, matched
+}
+
+// findDalleFile locates the exported file for a DALL-E asset and the media folder it is copied to
+func findDalleFile(mediaInfo *models.ChatGPTMediaInfo, fileID string) (models.MediaFile, string, bool) {
+	for _, file := range mediaInfo.DalleGenerations {
+		if parser.MatchesAssetFile(file.Name, fileID) {
+			return file, "dalle-generations", true
+		}
+	}
+	// Older exports store generated images next to conversations.json
+	for _, file := range mediaInfo.Images {
+		if parser.MatchesAssetFile(file.Name, fileID) {
+			return file, "images", true
+		}
+	}
+	return models.MediaFile{}, "", false
+}
+
+// saveDalleCatalog saves the DALL-E catalog to the output
+func (p *Processor) saveDalleCatalog(catalog models.MediaIndex, relPath string) error {
+	file, err := p.createOutput(relPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(catalog); err != nil {
+		return err
+	}
+	return file.Commit()
+}
+
+// saveDalleCatalogMarkdown writes a browsable prompt -> image catalog
+func (p *Processor) saveDalleCatalogMarkdown(catalog models.MediaIndex, relPath string) error {
+	file, err := p.createOutput(relPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writeDalleCatalogMarkdown(file, catalog)
+	return file.Commit()
+}
+
+// writeDalleCatalogMarkdown writes the browsable catalog to w
+func writeDalleCatalogMarkdown(w io.Writer, catalog models.MediaIndex) {
+	// Links are relative to chatgpt/media, paths in the catalog are relative to the output root
+	toLink := func(path string) string {
+		return filepath.ToSlash(filepath.Join("..", "..", path))
+	}
+
+	fmt.Fprintf(w, "# DALL-E Prompt Catalog\n\n")
+	fmt.Fprintf(w, "%d generated images.\n", len(catalog.Media))
+
+	currentConversation := ""
+	for _, item := range catalog.Media {
+		if item.ConversationID != currentConversation {
+			currentConversation = item.ConversationID
+			title := item.ConversationTitle
+			if title == "" {
+				title = item.ConversationID
+			}
+			if item.ConversationPath != "" {
+				fmt.Fprintf(w, "\n## [%s](<%s>)\n\n", title, toLink(item.ConversationPath))
+			} else {
+				fmt.Fprintf(w, "\n## %s\n\n", title)
+			}
+		}
+
+		prompt := strings.TrimSpace(item.Prompt)
+		if prompt == "" {
+			prompt = "*[No prompt recorded]*"
+		}
+
+		fmt.Fprintf(w, "### %s\n\n", item.CreatedAt.Format("2006-01-02 15:04:05"))
+		fmt.Fprintf(w, "%s\n\n", prompt)
+		if item.NewPath != "" {
+			fmt.Fprintf(w, "![%s](<%s>)\n\n", item.ID, toLink(item.NewPath))
+		} else {
+			fmt.Fprintf(w, "*Image %s not found in export*\n\n", item.ID)
+		}
+	}
+}
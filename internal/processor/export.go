@@ -0,0 +1,81 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/oisee/chat-transformer/internal/export"
+	"github.com/oisee/chat-transformer/internal/models"
+)
+
+// runExport writes the conversations that match the filter to the exporter, Claude
+// conversations first and each platform in export order, and commits it. Nothing
+// is written to the output directory. When ctx is cancelled or a write fails, the
+// export is discarded.
+func (p *Processor) runExport(ctx context.Context) error {
+	defer p.exporter.Close()
+	p.logger.Info("Exporting conversations...")
+
+	// The parsers report failed conversations and carry on, so a failed write
+	// cancels them instead
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var writeErr error
+	exported, filtered := 0, 0
+	write := func(conv models.Conversation) error {
+		if !p.filter.Matches(conv) {
+			filtered++
+			return nil
+		}
+		p.redactConversation(&conv)
+		if err := p.exporter.Write(conv); err != nil {
+			writeErr = fmt.Errorf("failed to export conversation %s: %w", conv.Metadata.ID, err)
+			cancel()
+			return nil
+		}
+		exported++
+		return nil
+	}
+
+	var err error
+	if !p.chatgptOnly {
+		err = p.claudeParser.ParseConversations(ctx, p.claudeProjectMap(), func(_ models.ClaudeConversation, conv models.Conversation) error {
+			return write(conv)
+		})
+		if err != nil && ctx.Err() == nil {
+			p.logger.Warn("Claude processing failed", "error", err)
+		}
+	}
+	if !p.claudeOnly && ctx.Err() == nil {
+		err = p.chatgptParser.ParseConversations(ctx, func(_ models.ChatGPTConversation, conv models.Conversation) error {
+			return write(conv)
+		})
+		if err != nil && ctx.Err() == nil {
+			p.logger.Warn("ChatGPT processing failed", "error", err)
+		}
+	}
+
+	if writeErr != nil {
+		return writeErr
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := p.exporter.Commit(); err != nil {
+		return fmt.Errorf("failed to finish export: %w", err)
+	}
+
+	p.logger.Info("Exported conversations", "count", exported, "filtered", filtered)
+
+	// Exports streamed to stdout have no directory to hold the redaction report
+	if p.redactor != nil {
+		p.logRedactions()
+		if p.outputPath != "" && p.outputPath != export.Stdout {
+			if err := p.saveRedactionReport(); err != nil {
+				p.logger.Warn("failed to write redaction report", "error", err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package processor
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/oisee/chat-transformer/internal/models"
+)
+
+// Length of the conversation ID suffix that keeps output filenames unique
+const shortIDLength = 8
+
+// shortID returns the first characters of a conversation ID that are safe in filenames
+func shortID(id string) string {
+	id = strings.ReplaceAll(pathValue(id), "-", "")
+	if id == "untitled" {
+		return ""
+	}
+	if len(id) > shortIDLength {
+		id = id[:shortIDLength]
+	}
+	return id
+}
+
+// claimOutputPath reserves relPath for a conversation. When another conversation
+// already claimed the same path in this run, the collision is reported and the
+// full conversation ID is used instead so neither file is overwritten.
+func (p *Processor) claimOutputPath(id, relPath string) string {
+	p.outputMutex.Lock()
+	defer p.outputMutex.Unlock()
+
+	owner, claimed := p.outputPaths[relPath]
+	if !claimed || owner == id {
+		p.outputPaths[relPath] = id
+		return relPath
+	}
+
+	resolved := strings.TrimSuffix(relPath, ".json") + "_" + pathValue(id) + ".json"
+	p.logger.Warn("conversation would overwrite another conversation's file, saving under its full ID",
+		"conversation_id", id, "path", relPath, "owner_id", owner, "saved_as", resolved)
+	p.collisions++
+	p.outputPaths[resolved] = id
+	return resolved
+}
+
+// claimProjectName reserves the {project} value of a Claude project. When another
+// project already claimed the same value in this run, the collision is reported
+// and the project ID is appended so the projects and their conversations stay apart.
+func (p *Processor) claimProjectName(project models.ClaudeProject) string {
+	p.outputMutex.Lock()
+	defer p.outputMutex.Unlock()
+
+	if name, claimed := p.projectNames[project.UUID]; claimed {
+		return name
+	}
+
+	name := sanitizeProject(project.Name)
+	if owner, claimed := p.projectOwners[name]; claimed {
+		resolved := name + "_" + pathValue(project.UUID)
+		p.logger.Warn("project has the same name as another project, saving it under its ID as well",
+			"project_id", project.UUID, "name", name, "owner_id", owner, "saved_as", resolved)
+		name = resolved
+	}
+	p.projectOwners[name] = project.UUID
+	p.projectNames[project.UUID] = name
+	return name
+}
+
+// projectName returns the {project} value claimed by the Claude project with
+// the given ID, or the sanitized name for projects that were not claimed
+func (p *Processor) projectName(projectID, name string) string {
+	p.outputMutex.Lock()
+	defer p.outputMutex.Unlock()
+
+	if claimed, ok := p.projectNames[projectID]; ok && projectID != "" {
+		return claimed
+	}
+	return sanitizeProject(name)
+}
+
+// conversationFiles returns the conversation files of this run, sorted
+func (p *Processor) conversationFiles() []string {
+	p.outputMutex.Lock()
+	defer p.outputMutex.Unlock()
+
+	files := make([]string, 0, len(p.outputPaths))
+	for path := range p.outputPaths {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return files
+}
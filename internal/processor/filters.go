@@ -0,0 +1,128 @@
+package processor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/oisee/chat-transformer/internal/models"
+)
+
+// Filter selects which conversations a run processes. The zero value selects everything.
+type Filter struct {
+	Since       time.Time      // keep conversations created at or after Since
+	Until       time.Time      // keep conversations created at or before Until
+	Projects    []string       // keep conversations in one of these projects (case-insensitive)
+	TitleMatch  *regexp.Regexp // keep conversations whose title matches
+	MinMessages int            // keep conversations with at least this many messages
+	IDs         map[string]bool
+}
+
+// IsEmpty reports whether the filter selects every conversation
+func (f Filter) IsEmpty() bool {
+	return f.Since.IsZero() && f.Until.IsZero() && len(f.Projects) == 0 &&
+		f.TitleMatch == nil && f.MinMessages == 0 && f.IDs == nil
+}
+
+// String describes the active filter criteria
+func (f Filter) String() string {
+	var parts []string
+	if !f.Since.IsZero() {
+		parts = append(parts, "since "+f.Since.Format(time.RFC3339))
+	}
+	if !f.Until.IsZero() {
+		parts = append(parts, "until "+f.Until.Format(time.RFC3339))
+	}
+	if len(f.Projects) > 0 {
+		parts = append(parts, "project "+strings.Join(f.Projects, ", "))
+	}
+	if f.TitleMatch != nil {
+		parts = append(parts, fmt.Sprintf("title matching %q", f.TitleMatch.String()))
+	}
+	if f.MinMessages > 0 {
+		parts = append(parts, fmt.Sprintf("at least %d messages", f.MinMessages))
+	}
+	if f.IDs != nil {
+		parts = append(parts, fmt.Sprintf("%d listed IDs", len(f.IDs)))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Matches reports whether a conversation is selected by the filter
+func (f Filter) Matches(conv models.Conversation) bool {
+	metadata := conv.Metadata
+
+	if !f.Since.IsZero() && metadata.CreatedDate.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && metadata.CreatedDate.After(f.Until) {
+		return false
+	}
+	if len(f.Projects) > 0 && !f.MatchesProject(metadata.Project) {
+		return false
+	}
+	if f.TitleMatch != nil && !f.TitleMatch.MatchString(metadata.Title) {
+		return false
+	}
+	if len(conv.Messages) < f.MinMessages {
+		return false
+	}
+	if f.IDs != nil && !f.IDs[metadata.ID] {
+		return false
+	}
+	return true
+}
+
+// MatchesProject reports whether a project is selected by the filter
+func (f Filter) MatchesProject(project string) bool {
+	if len(f.Projects) == 0 {
+		return true
+	}
+	for _, name := range f.Projects {
+		if strings.EqualFold(strings.TrimSpace(name), project) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseFilterDate parses a --since/--until value, either a date (2006-01-02) or an
+// RFC 3339 timestamp. With endOfDay set, a plain date stands for the last instant
+// of the day, so an inclusive Until selects the whole day.
+func ParseFilterDate(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q (expected YYYY-MM-DD or RFC 3339)", value)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
+
+// LoadIDsFile reads conversation IDs, one per line. Blank lines and lines
+// starting with # are ignored.
+func LoadIDsFile(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ids := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ids[line] = true
+	}
+	return ids, scanner.Err()
+}
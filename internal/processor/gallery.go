@@ -0,0 +1,241 @@
+package processor
+
+import (
+	"html/template"
+	"io"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/oisee/chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/parser"
+	"github.com/oisee/chat-transformer/internal/renderer"
+)
+
+// conversationRef identifies the conversation an image appeared in
+type conversationRef struct {
+	id       string
+	title    string
+	filePath string
+	created  time.Time
+}
+
+// galleryImage is a single thumbnail in the gallery
+type galleryImage struct {
+	Name      string
+	Thumbnail string
+	Source    string
+	Width     int
+	Height    int
+}
+
+// galleryConversation groups the images of one conversation
+type galleryConversation struct {
+	Title  string
+	Link   string
+	Images []galleryImage
+}
+
+// galleryMonth groups conversations by the month they were created
+type galleryMonth struct {
+	Month         string
+	Conversations []*galleryConversation
+}
+
+// recordImageReferences remembers which conversation each image asset appeared in
+func (p *Processor) recordImageReferences(chatgpt models.ChatGPTConversation, metadata models.ConversationMetadata) {
+	ref := conversationRef{
+		id:       metadata.ID,
+		title:    metadata.Title,
+		filePath: metadata.FilePath,
+		created:  metadata.CreatedDate,
+	}
+
+	p.mediaMutex.Lock()
+	defer p.mediaMutex.Unlock()
+
+	for _, node := range chatgpt.Mapping {
+		if node.Message == nil {
+			continue
+		}
+		for _, asset := range node.Message.Content.Assets {
+			if asset.ContentType == "image_asset_pointer" {
+				p.imageRefs[parser.AssetFileID(asset.AssetPointer)] = ref
+			}
+		}
+	}
+}
+
+// generateGallery writes chatgpt/media/gallery.html
+func (p *Processor) generateGallery(mediaInfo *models.ChatGPTMediaInfo) error {
+	file, err := p.createOutput(filepath.Join("chatgpt", "media", "gallery.html"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	total, err := p.writeGallery(file, mediaInfo)
+	if err != nil {
+		return err
+	}
+	if err := file.Commit(); err != nil {
+		return err
+	}
+
+	p.logger.Info("Generated media gallery", "images", total)
+	return nil
+}
+
+// writeGallery writes the gallery page to w with the export's images grouped by
+// month and conversation, each thumbnail linking to its conversation's rendered
+// page, and returns the number of images shown
+func (p *Processor) writeGallery(w io.Writer, mediaInfo *models.ChatGPTMediaInfo) (int, error) {
+	// Paths in the gallery are relative to the media directory
+	toLink := func(relToOutput string) string {
+		return filepath.ToSlash(filepath.Join("..", "..", relToOutput))
+	}
+
+	groups := []struct {
+		folder string
+		files  []models.MediaFile
+	}{
+		{"images", mediaInfo.Images},
+		{"dalle-generations", mediaInfo.DalleGenerations},
+		{"user-uploads", mediaInfo.UserUploads},
+	}
+
+	p.mediaMutex.Lock()
+	refs := make(map[string]conversationRef, len(p.imageRefs))
+	for fileID, ref := range p.imageRefs {
+		refs[fileID] = ref
+	}
+	p.mediaMutex.Unlock()
+
+	months := make(map[string]*galleryMonth)
+	conversations := make(map[string]*galleryConversation)
+	seen := make(map[string]bool)
+	total := 0
+
+	for _, group := range groups {
+		for _, file := range group.files {
+			if file.Kind != "image" {
+				continue
+			}
+
+			ref, linked := findImageReference(refs, file.Name)
+			key := ref.id
+			if !linked {
+				// Images that no conversation refers to are grouped by file date
+				ref = conversationRef{title: "Unlinked images", created: file.Modified}
+				key = "unlinked-" + file.Modified.Format("2006-01")
+			}
+
+			// The same upload can appear in several export folders
+			if seen[key+"/"+file.Name] {
+				continue
+			}
+			seen[key+"/"+file.Name] = true
+
+			source := toLink(p.mediaReferencePath(file, group.folder))
+			thumbnail := source
+			if thumbPath, ok := p.thumbnails[file.Path]; ok {
+				thumbnail = filepath.ToSlash(thumbPath)
+			}
+
+			conv, exists := conversations[key]
+			if !exists {
+				conv = &galleryConversation{Title: ref.title}
+				if linked {
+					conv.Link = toLink(p.renderedConversationPath(ref.filePath))
+				}
+				conversations[key] = conv
+
+				month := ref.created.Format("2006-01")
+				if _, ok := months[month]; !ok {
+					months[month] = &galleryMonth{Month: month}
+				}
+				months[month].Conversations = append(months[month].Conversations, conv)
+			}
+
+			conv.Images = append(conv.Images, galleryImage{
+				Name:      file.Name,
+				Thumbnail: thumbnail,
+				Source:    source,
+				Width:     file.Width,
+				Height:    file.Height,
+			})
+			total++
+		}
+	}
+
+	// Newest months first
+	ordered := make([]*galleryMonth, 0, len(months))
+	for _, month := range months {
+		sort.Slice(month.Conversations, func(i, j int) bool {
+			return month.Conversations[i].Title < month.Conversations[j].Title
+		})
+		ordered = append(ordered, month)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		return ordered[i].Month > ordered[j].Month
+	})
+
+	data := map[string]interface{}{
+		"Total":  total,
+		"Months": ordered,
+	}
+	return total, galleryTemplate.Execute(w, data)
+}
+
+// findImageReference finds the conversation that referenced an exported image file.
+// The file IDs the name can belong to are looked up shortest first, so the same
+// file always gets the same reference.
+func findImageReference(refs map[string]conversationRef, name string) (conversationRef, bool) {
+	for _, fileID := range parser.AssetFileIDs(name) {
+		if ref, ok := refs[fileID]; ok {
+			return ref, true
+		}
+	}
+	return conversationRef{}, false
+}
+
+// renderedConversationPath maps a conversation JSON path to its rendered markdown page
+// when markdown rendering is enabled, or returns the JSON path otherwise
+func (p *Processor) renderedConversationPath(jsonPath string) string {
+	if p.renderMarkdown {
+		return renderer.MarkdownPath(jsonPath)
+	}
+	return jsonPath
+}
+
+var galleryTemplate = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>ChatGPT Media Gallery</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+h2 { border-bottom: 1px solid #ccc; }
+.grid { display: flex; flex-wrap: wrap; gap: 8px; }
+.grid a img { max-width: 200px; max-height: 200px; object-fit: contain; background: #f4f4f4; }
+.caption { font-size: 0.8em; color: #666; }
+</style>
+</head>
+<body>
+<h1>ChatGPT Media Gallery</h1>
+<p>{{.Total}} images</p>
+{{range .Months}}
+<h2>{{.Month}}</h2>
+{{range .Conversations}}
+<h3>{{if .Link}}<a href="{{.Link}}">{{.Title}}</a>{{else}}{{.Title}}{{end}}</h3>
+<div class="grid">
+{{$link := .Link}}{{range .Images}}<figure>
+<a href="{{if $link}}{{$link}}{{else}}{{.Source}}{{end}}"><img src="{{.Thumbnail}}" alt="{{.Name}}" loading="lazy"></a>
+<figcaption class="caption"><a href="{{.Source}}">{{.Name}}</a>{{if .Width}} ({{.Width}}×{{.Height}}){{end}}</figcaption>
+</figure>
+{{end}}</div>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
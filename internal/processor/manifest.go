@@ -0,0 +1,174 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/oisee/chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/parser"
+	"github.com/oisee/chat-transformer/internal/renderer"
+)
+
+// File (inside the output directory) recording what earlier runs processed
+const manifestFile = "processing_manifest.json"
+
+// loadManifest loads the manifest of the previous run into the output directory.
+// Without a usable manifest, or when the converter, renderer or output-affecting
+// settings changed since it was written, every conversation is rebuilt.
+func (p *Processor) loadManifest() {
+	p.manifest = models.Manifest{
+		ConverterVersion: parser.ConverterVersion,
+		RendererVersion:  renderer.FormatVersion,
+		Settings:         p.manifestSettings(),
+		Conversations:    make(map[string]models.ManifestEntry),
+	}
+	p.manifestOutputs = make(map[string]int)
+
+	if p.fullRebuild {
+		p.logger.Info("Full rebuild requested, rewriting all conversations")
+		return
+	}
+	if p.redactor != nil {
+		// Placeholders are numbered per run, so skipped files would disagree with rewritten ones
+		p.logger.Info("Redacting, rewriting all conversations")
+		return
+	}
+
+	data, err := p.readOutput(manifestFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		p.logger.Warn("failed to read manifest, rebuilding all conversations", "path", manifestFile, "error", err)
+		return
+	}
+
+	var previous models.Manifest
+	if err := json.Unmarshal(data, &previous); err != nil {
+		p.logger.Warn("failed to parse manifest, rebuilding all conversations", "path", manifestFile, "error", err)
+		return
+	}
+
+	if previous.ConverterVersion != p.manifest.ConverterVersion ||
+		previous.RendererVersion != p.manifest.RendererVersion ||
+		previous.Settings != p.manifest.Settings {
+		p.logger.Info("Converter, renderer or settings changed since the last run, rebuilding all conversations")
+		return
+	}
+
+	if previous.Conversations != nil {
+		p.setManifestConversations(previous.Conversations)
+	}
+	p.incremental = true
+	p.renderer.SetIncremental(true)
+	p.logger.Info("Loaded manifest of the previous run", "conversations", len(p.manifest.Conversations))
+}
+
+// setManifestConversations replaces the manifest entries with those of an earlier
+// run and counts the conversations written to each output path
+func (p *Processor) setManifestConversations(conversations map[string]models.ManifestEntry) {
+	p.manifest.Conversations = conversations
+	p.manifestOutputs = make(map[string]int, len(conversations))
+	for _, entry := range conversations {
+		p.manifestOutputs[entry.OutputPath]++
+	}
+}
+
+// manifestSettings describes the options that change the content of conversation files
+func (p *Processor) manifestSettings() string {
+	settings := fmt.Sprintf("media-mode=%s content-addressed=%t media-template=%s", p.mediaMode, p.contentAddressed, p.templates.Media)
+	if p.redactor != nil {
+		settings += " redacted=true"
+	}
+	return settings
+}
+
+// isUnchanged reports whether a conversation was already written to relPath by a
+// previous run from the same source
+func (p *Processor) isUnchanged(id, hash, relPath string) bool {
+	if !p.incremental {
+		return false
+	}
+
+	p.manifestMutex.Lock()
+	entry, ok := p.manifest.Conversations[id]
+	p.manifestMutex.Unlock()
+
+	if !ok || entry.SourceHash != hash || entry.OutputPath != relPath {
+		return false
+	}
+	return p.outputExists(relPath)
+}
+
+// recordConversation stores the manifest entry of a conversation that was just
+// written, removing the output of a previous run that used a different path
+func (p *Processor) recordConversation(id, hash, relPath string) {
+	p.manifestMutex.Lock()
+	defer p.manifestMutex.Unlock()
+
+	if entry, ok := p.manifest.Conversations[id]; ok {
+		p.manifestOutputs[entry.OutputPath]--
+		if entry.OutputPath != relPath && p.manifestOutputs[entry.OutputPath] == 0 {
+			// No other conversation in the manifest was written there
+			p.removeStaleOutput(entry.OutputPath)
+		}
+	}
+	p.manifestOutputs[relPath]++
+
+	p.manifest.Conversations[id] = models.ManifestEntry{
+		SourceHash:  hash,
+		OutputPath:  relPath,
+		ProcessedAt: p.now(),
+	}
+	p.checkpointConversation()
+}
+
+// removeStaleOutput deletes a conversation file (and its markdown) written by a previous run
+func (p *Processor) removeStaleOutput(relPath string) {
+	stale := []string{relPath}
+	if p.renderMarkdown {
+		if mdPath := p.renderedConversationPath(relPath); mdPath != relPath {
+			stale = append(stale, mdPath)
+		}
+	}
+
+	for _, path := range stale {
+		if err := p.removeOutput(path); err != nil {
+			p.logger.Warn("failed to remove stale output", "path", path, "error", err)
+		}
+	}
+}
+
+// saveManifest writes the manifest for the next run
+func (p *Processor) saveManifest() error {
+	p.manifest.LastUpdated = p.now()
+
+	file, err := p.createOutput(manifestFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(p.manifest); err != nil {
+		return err
+	}
+	return file.Commit()
+}
+
+// sourceHash hashes a parsed source conversation together with any other inputs
+// that shape its output
+func sourceHash(source interface{}, extra ...interface{}) string {
+	hasher := sha256.New()
+	encoder := json.NewEncoder(hasher)
+	encoder.Encode(source)
+	for _, value := range extra {
+		encoder.Encode(value)
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
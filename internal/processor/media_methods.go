@@ -1,77 +1,160 @@
 package processor
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 
-	"chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/utils"
 )
 
-// copyChatGPTMediaFiles copies media files to organized folders when copyMedia flag is set
-func (p *Processor) copyChatGPTMediaFiles(mediaInfo *models.ChatGPTMediaInfo) error {
-	mediaBase := filepath.Join(p.outputPath, "chatgpt", "media")
+// copyChatGPTMediaFiles places media files in organized folders (copied or linked
+// according to the media mode) when copyMedia is set. It stops before the next
+// file when ctx is cancelled.
+func (p *Processor) copyChatGPTMediaFiles(ctx context.Context, mediaInfo *models.ChatGPTMediaInfo) error {
+	mediaBase := filepath.Join("chatgpt", "media")
 
 	// Create organized subdirectories
 	dirs := []string{
 		"images",
 		"dalle-generations",
 		"user-uploads",
+		"files",
 		"audio-conversations",
 	}
 
 	for _, dir := range dirs {
-		if err := os.MkdirAll(filepath.Join(mediaBase, dir), 0755); err != nil {
+		if err := p.output.MkdirAll(filepath.ToSlash(filepath.Join(mediaBase, dir))); err != nil {
 			return fmt.Errorf("failed to create media directory %s: %w", dir, err)
 		}
 	}
 
+	// Open the content-addressed store when requested
+	var store *mediaStore
+	if p.contentAddressed {
+		var err error
+		store, err = openMediaStore(p.output, mediaBase, p.input)
+		if err != nil {
+			return fmt.Errorf("failed to open media store: %w", err)
+		}
+
+		// Keep the index of the objects stored so far when the run is cancelled
+		defer func() {
+			if ctx.Err() == nil {
+				return
+			}
+			if err := store.save(p.now()); err != nil {
+				p.logger.Warn("failed to save media store index", "error", err)
+			}
+		}()
+	}
+
 	// Copy images
-	for _, file := range mediaInfo.Images {
-		destPath := filepath.Join(mediaBase, "images", file.Name)
-		if err := p.copyFile(file.Path, destPath); err != nil {
-			fmt.Printf("Warning: failed to copy image %s: %v\n", file.Name, err)
+	for i := range mediaInfo.Images {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		file := &mediaInfo.Images[i]
+		if err := p.storeMediaFile(store, file, "images"); err != nil {
+			p.report.recordFailure("media", file.Name, err)
 		}
 	}
 
 	// Copy DALL-E generations
-	for _, file := range mediaInfo.DalleGenerations {
-		destPath := filepath.Join(mediaBase, "dalle-generations", file.Name)
-		if err := p.copyFile(file.Path, destPath); err != nil {
-			fmt.Printf("Warning: failed to copy DALL-E image %s: %v\n", file.Name, err)
+	for i := range mediaInfo.DalleGenerations {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		file := &mediaInfo.DalleGenerations[i]
+		if err := p.storeMediaFile(store, file, "dalle-generations"); err != nil {
+			p.report.recordFailure("media", file.Name, err)
 		}
 	}
 
 	// Copy user uploads
-	for _, file := range mediaInfo.UserUploads {
-		destPath := filepath.Join(mediaBase, "user-uploads", file.Name)
-		if err := p.copyFile(file.Path, destPath); err != nil {
-			fmt.Printf("Warning: failed to copy user upload %s: %v\n", file.Name, err)
+	for i := range mediaInfo.UserUploads {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		file := &mediaInfo.UserUploads[i]
+		if err := p.storeMediaFile(store, file, "user-uploads"); err != nil {
+			p.report.recordFailure("media", file.Name, err)
+		}
+	}
+
+	// Copy other files
+	for i := range mediaInfo.Files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		file := &mediaInfo.Files[i]
+		if err := p.storeMediaFile(store, file, "files"); err != nil {
+			p.report.recordFailure("media", file.Name, err)
 		}
 	}
 
 	// Copy audio conversations
 	for _, audioConv := range mediaInfo.AudioConversations {
-		convDir := filepath.Join(mediaBase, "audio-conversations", audioConv.ConversationID)
-		if err := os.MkdirAll(convDir, 0755); err != nil {
-			fmt.Printf("Warning: failed to create audio conversation directory %s: %v\n", audioConv.ConversationID, err)
-			continue
+		folder := filepath.Join("audio-conversations", audioConv.ConversationID)
+		for i := range audioConv.AudioFiles {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			file := &audioConv.AudioFiles[i]
+			if err := p.storeMediaFile(store, file, folder); err != nil {
+				p.report.recordFailure("media", file.Name, err)
+			}
 		}
+	}
 
-		for _, file := range audioConv.AudioFiles {
-			destPath := filepath.Join(convDir, file.Name)
-			if err := p.copyFile(file.Path, destPath); err != nil {
-				fmt.Printf("Warning: failed to copy audio file %s: %v\n", file.Name, err)
-			}
+	if store != nil {
+		if err := store.save(p.now()); err != nil {
+			return fmt.Errorf("failed to save media store index: %w", err)
 		}
+		p.logger.Info("Updated media store", "added", store.added, "already_stored", store.reused)
 	}
 
 	// Create helpful README files for media processing
 	return p.createMediaREADMEs(mediaBase)
 }
 
-// copyFile copies a file from src to dst
+// mediaReferencePath returns the path of a media file relative to the output root:
+// its copy in the given media folder when media is copied, the export file otherwise
+func (p *Processor) mediaReferencePath(file models.MediaFile, folder string) string {
+	if p.copyMedia && p.contentAddressed && file.SHA256 != "" {
+		return filepath.Join("chatgpt", "media", objectPath(file.SHA256, file.Name))
+	}
+	if p.copyMedia {
+		return p.mediaPath(folder, file.Name)
+	}
+	return p.getRelativeMediaPath(file.Path)
+}
+
+// storeMediaFile places a media file into its media folder, or into the
+// content-addressed store when one is given
+func (p *Processor) storeMediaFile(store *mediaStore, file *models.MediaFile, folder string) error {
+	if store == nil {
+		mode, err := p.placeMediaFile(file.Path, p.mediaPath(folder, file.Name))
+		if err != nil {
+			return err
+		}
+		file.LinkMode = mode
+		return nil
+	}
+
+	hash, mode, err := store.put(file.Path, filepath.Join(folder, file.Name), p.placeMediaFile)
+	if err != nil {
+		return err
+	}
+	file.SHA256 = hash
+	file.LinkMode = mode
+	return nil
+}
+
+// copyFile copies a file from src to dst on disk
 func (p *Processor) copyFile(src, dst string) error {
 	srcFile, err := os.Open(src)
 	if err != nil {
@@ -79,19 +162,53 @@ func (p *Processor) copyFile(src, dst string) error {
 	}
 	defer srcFile.Close()
 
-	dstFile, err := os.Create(dst)
+	dstFile, err := utils.CreateAtomic(dst)
 	if err != nil {
 		return err
 	}
 	defer dstFile.Close()
 
-	_, err = io.Copy(dstFile, srcFile)
-	return err
+	if _, err := io.Copy(dstFile, srcFile); err != nil {
+		return err
+	}
+	return dstFile.Commit()
+}
+
+// copyInputFile copies a file of the input to the output file at relPath
+func (p *Processor) copyInputFile(src, relPath string) error {
+	srcFile, err := p.input.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := p.createOutput(relPath)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+
+	if _, err := io.Copy(dstFile, srcFile); err != nil {
+		return err
+	}
+	return dstFile.Commit()
 }
 
 // createMediaREADMEs creates helpful README files for media processing
 func (p *Processor) createMediaREADMEs(mediaBase string) error {
-	readmes := map[string]string{
+	for path, content := range mediaREADMEFiles() {
+		if err := p.writeOutput(filepath.Join(mediaBase, path), []byte(content)); err != nil {
+			return fmt.Errorf("failed to create %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// mediaREADMEFiles returns the README files of the media folders, by path
+// relative to the media directory
+func mediaREADMEFiles() map[string]string {
+	return map[string]string{
 		"images/README.md": `# Images from ChatGPT Conversations
 
 This directory contains images that were uploaded to or referenced in ChatGPT conversations.
@@ -140,36 +257,20 @@ done
 
 This directory contains AI-generated images from DALL-E in ChatGPT conversations.
 
-## Processing Suggestions
+## Prompt Catalog
 
-### Metadata Extraction
-DALL-E images often contain generation prompts in their metadata or filenames.
+The prompt behind each image is captured during transformation from the DALL-E
+tool calls and the generation metadata of the image assets:
 
-` + "```bash" + `
-# Extract metadata from images
-exiftool *.{jpg,jpeg,png,webp} > metadata.txt
+- **../dalle_catalog.md** - Browsable catalog of prompt -> image, grouped by conversation
+- **../dalle_catalog.json** - Machine-readable catalog with file IDs, gen IDs and conversation IDs
 
-# Look for generation prompts in conversation history
-grep -r "dall-e\|generate.*image\|create.*image" ../../chats/
-` + "```" + `
+## Processing Suggestions
 
-### Prompt Recreation
+### Metadata Extraction
 ` + "```bash" + `
-# Create a catalog of prompts and results
-python -c "
-import json
-from pathlib import Path
-
-# Load conversations and find DALL-E references
-for conv_file in Path('../../chats').rglob('*.json'):
-    with open(conv_file) as f:
-        data = json.load(f)
-        for msg in data.get('messages', []):
-            if 'dall' in msg.get('content', '').lower():
-                print(f'Conversation: {conv_file.name}')
-                print(f'Prompt: {msg[\"content\"][:100]}...')
-                print('---')
-"
+# Extract embedded metadata from images
+exiftool *.{jpg,jpeg,png,webp} > metadata.txt
 ` + "```" + `
 `,
 
@@ -208,83 +309,17 @@ done
 
 		"audio-conversations/README.md": `# Audio Conversations
 
-This directory contains audio files from ChatGPT voice conversations.
-
-## Processing Suggestions
-
-### Transcription with Whisper
-` + "```bash" + `
-# Install OpenAI Whisper
-pip install openai-whisper
-
-# Transcribe all audio files
-for audio_dir in */; do
-    echo "Processing conversation: $audio_dir"
-    cd "$audio_dir"
-    for audio in *.wav; do
-        whisper "$audio" --output_format txt --output_dir transcripts/
-    done
-    cd ..
-done
-` + "```" + `
+This directory contains audio files from ChatGPT voice conversations, one folder
+per conversation ID.
 
-### Batch Processing with APIs
-` + "```bash" + `
-# Using OpenAI Whisper API
-for audio_dir in */; do
-    cd "$audio_dir"
-    for audio in *.wav; do
-        curl -X POST https://api.openai.com/v1/audio/transcriptions \
-          -H "Authorization: Bearer $OPENAI_API_KEY" \
-          -H "Content-Type: multipart/form-data" \
-          -F file="@$audio" \
-          -F model="whisper-1" \
-          > "${audio%.wav}_transcript.json"
-    done
-    cd ..
-done
-` + "```" + `
+## Transcripts
 
-### Analysis Scripts
-` + "```python" + `
-# Python script to organize transcripts
-import json
-import os
-from pathlib import Path
+Voice messages are linked to their audio during transformation:
 
-def process_conversation_audio(conv_dir):
-    transcripts = []
-    for audio_file in Path(conv_dir).glob("*_transcript.json"):
-        with open(audio_file) as f:
-            data = json.load(f)
-            transcripts.append({
-                "file": audio_file.stem,
-                "text": data.get("text", ""),
-                "timestamp": audio_file.stat().st_mtime
-            })
-    
-    # Sort by timestamp and combine
-    transcripts.sort(key=lambda x: x["timestamp"])
-    full_conversation = "\n\n".join([t["text"] for t in transcripts])
-    
-    # Save combined transcript
-    with open(f"{conv_dir}/full_conversation.txt", "w") as f:
-        f.write(full_conversation)
-
-# Process all conversation directories
-for conv_dir in Path(".").glob("*/"):
-    if conv_dir.is_dir():
-        process_conversation_audio(conv_dir)
-` + "```" + `
+- Each message in the conversation JSON lists its **audio** clips with the
+  transcript text, direction and start/end offsets where the export provides them
+- Rendered markdown shows the transcript with a link to each clip
+- **../media_info.json** lists the clips of every audio conversation with their message IDs
 `,
 	}
-
-	for path, content := range readmes {
-		fullPath := filepath.Join(mediaBase, path)
-		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
-			return fmt.Errorf("failed to create %s: %w", path, err)
-		}
-	}
-
-	return nil
-}
\ No newline at end of file
+}
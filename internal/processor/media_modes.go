@@ -0,0 +1,106 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Media modes control how media files end up in the output directory
+const (
+	MediaModeReference = "reference" // keep relative paths into the export
+	MediaModeCopy      = "copy"      // copy files into the output
+	MediaModeHardlink  = "hardlink"  // hard link files, copying across filesystems
+	MediaModeSymlink   = "symlink"   // symlink files, copying where symlinks are unsupported
+)
+
+// mediaModeFallback is reported for files that were copied because linking failed
+const mediaModeFallback = "copy (fallback)"
+
+// ValidMediaModes lists the accepted media modes
+var ValidMediaModes = []string{MediaModeReference, MediaModeCopy, MediaModeHardlink, MediaModeSymlink}
+
+// placeMediaFile materializes src at dst, relative to the output root, using
+// the configured media mode and returns the mode that was actually used
+func (p *Processor) placeMediaFile(src, dst string) (string, error) {
+	// Replace whatever a previous run left behind; copying onto a link it
+	// placed would overwrite the file in the export
+	if err := p.removeOutput(dst); err != nil {
+		return "", err
+	}
+
+	mode := p.mediaMode
+	if (mode == MediaModeHardlink || mode == MediaModeSymlink) && (!p.input.OnDisk() || p.outputPath == "") {
+		// Only files on disk can be linked to, and only from an output on disk
+		mode = mediaModeFallback
+	} else if mode == MediaModeHardlink || mode == MediaModeSymlink {
+		if err := p.output.MkdirAll(filepath.ToSlash(filepath.Dir(dst))); err != nil {
+			return "", err
+		}
+
+		linkPath := filepath.Join(p.outputPath, dst)
+		var linkErr error
+		if mode == MediaModeHardlink {
+			linkErr = os.Link(src, linkPath)
+		} else {
+			target, err := symlinkTarget(src, linkPath)
+			if err != nil {
+				return "", err
+			}
+			linkErr = os.Symlink(target, linkPath)
+		}
+		if linkErr == nil {
+			p.recordMediaMode(mode)
+			return mode, nil
+		}
+
+		// Hard links cannot cross filesystems and symlinks may be unsupported
+		mode = mediaModeFallback
+	} else {
+		mode = MediaModeCopy
+	}
+
+	if err := p.copyInputFile(src, dst); err != nil {
+		return "", err
+	}
+	p.recordMediaMode(mode)
+	return mode, nil
+}
+
+// symlinkTarget returns the path of src relative to the directory of the link
+// dst, so links keep working when the output and the export are moved together
+func symlinkTarget(src, dst string) (string, error) {
+	source, err := filepath.Abs(src)
+	if err != nil {
+		return "", err
+	}
+	linkDir, err := filepath.Abs(filepath.Dir(dst))
+	if err != nil {
+		return "", err
+	}
+	if target, err := filepath.Rel(linkDir, source); err == nil {
+		return target, nil
+	}
+	// Paths on different volumes have no relative form
+	return source, nil
+}
+
+// recordMediaMode counts the media mode used for a file
+func (p *Processor) recordMediaMode(mode string) {
+	p.mediaModeCounts[mode]++
+}
+
+// mediaModeCountAttrs returns the number of files placed with each mode as log fields
+func (p *Processor) mediaModeCountAttrs() []interface{} {
+	modes := make([]string, 0, len(p.mediaModeCounts))
+	for mode := range p.mediaModeCounts {
+		modes = append(modes, mode)
+	}
+	sort.Strings(modes)
+
+	attrs := make([]interface{}, 0, 2*len(modes))
+	for _, mode := range modes {
+		attrs = append(attrs, mode, p.mediaModeCounts[mode])
+	}
+	return attrs
+}
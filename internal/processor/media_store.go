@@ -0,0 +1,143 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oisee/chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/parser"
+	"github.com/oisee/chat-transformer/internal/sink"
+)
+
+const (
+	// Directory (inside the media directory) holding content-addressed objects
+	mediaObjectsDir = "objects"
+
+	// File (inside the media directory) mapping media names to object hashes
+	mediaStoreIndexFile = "media_store.json"
+)
+
+// mediaStore is a content-addressed store of media files keyed by SHA-256.
+// The store persists across runs into the same output directory, so a file
+// is only copied the first time its content is seen.
+type mediaStore struct {
+	output    sink.Tree
+	mediaBase string       // the media directory, relative to the output root
+	input     parser.Input // where the stored files are read from
+	index     models.MediaStoreIndex
+	added     int
+	reused    int
+}
+
+// openMediaStore loads the media store index from a media directory of the
+// output, creating an empty one if needed
+func openMediaStore(output sink.Tree, mediaBase string, input parser.Input) (*mediaStore, error) {
+	store := &mediaStore{
+		output:    output,
+		mediaBase: mediaBase,
+		input:     input,
+		index: models.MediaStoreIndex{
+			Objects: make(map[string]models.MediaObject),
+			Names:   make(map[string]string),
+		},
+	}
+
+	data, err := fs.ReadFile(output, filepath.ToSlash(filepath.Join(mediaBase, mediaStoreIndexFile)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store.index); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", mediaStoreIndexFile, err)
+	}
+	if store.index.Objects == nil {
+		store.index.Objects = make(map[string]models.MediaObject)
+	}
+	if store.index.Names == nil {
+		store.index.Names = make(map[string]string)
+	}
+
+	return store, nil
+}
+
+// put stores the file at src under its content hash and records it under name.
+// The file is only placed (using place, with a destination relative to the output
+// root) when no object with the same hash exists yet; the returned mode is
+// "deduplicated" for content that was already stored.
+func (s *mediaStore) put(src, name string, place func(src, dst string) (string, error)) (string, string, error) {
+	hash, size, err := hashFile(s.input, src)
+	if err != nil {
+		return "", "", err
+	}
+
+	relPath := objectPath(hash, name)
+	destPath := filepath.Join(s.mediaBase, relPath)
+
+	mode := "deduplicated"
+	if _, err := fs.Stat(s.output, filepath.ToSlash(destPath)); err == nil {
+		s.reused++
+	} else {
+		if mode, err = place(src, destPath); err != nil {
+			return "", "", err
+		}
+		s.added++
+	}
+
+	s.index.Objects[hash] = models.MediaObject{
+		Path: filepath.ToSlash(relPath),
+		Size: size,
+	}
+	s.index.Names[filepath.ToSlash(name)] = hash
+
+	return hash, mode, nil
+}
+
+// save writes the media store index, recording now as its last update
+func (s *mediaStore) save(now time.Time) error {
+	s.index.LastUpdated = now
+
+	file, err := s.output.Create(filepath.ToSlash(filepath.Join(s.mediaBase, mediaStoreIndexFile)))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(s.index); err != nil {
+		return err
+	}
+	return file.Commit()
+}
+
+// objectPath returns the path of an object relative to the media directory,
+// sharded by the first two hex digits and keeping the original extension
+func objectPath(hash, name string) string {
+	return filepath.Join(mediaObjectsDir, hash[:2], hash+strings.ToLower(filepath.Ext(name)))
+}
+
+// hashFile computes the SHA-256 of a file of the input
+func hashFile(input parser.Input, path string) (string, int64, error) {
+	file, err := input.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), size, nil
+}
@@ -0,0 +1,119 @@
+package processor
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/oisee/chat-transformer/internal/export"
+	"github.com/oisee/chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/redact"
+	"github.com/oisee/chat-transformer/internal/sink"
+)
+
+// Options configure a transformation run. The zero value of a field selects its
+// default, so only an input and an output are required.
+type Options struct {
+	InputPath  string    // directory holding the claude-* and chat-gpt-* export folders
+	InputFS    fs.FS     // the same folders from any file system; used instead of InputPath when set
+	OutputPath string    // directory the expanded output is written to
+	Sink       sink.Sink // receives the finished output; with no OutputPath the run is built in memory
+
+	// Exporter receives the selected conversations instead of the expanded output.
+	// Media, markdown and output layout options do not apply to exports.
+	Exporter export.Exporter
+
+	MediaMode             string // reference (default), copy, hardlink or symlink
+	ContentAddressedMedia bool   // store placed media by SHA-256; requires a media mode other than reference
+	Gallery               bool   // create image thumbnails and the HTML media gallery
+
+	ClaudeOnly     bool // process only Claude conversations
+	ChatGPTOnly    bool // process only ChatGPT conversations
+	RenderMarkdown bool // render conversations and projects to markdown
+	Filter         Filter
+
+	Redact      bool          // replace personal data and secrets with placeholders before conversations are written
+	RedactRules []redact.Rule // applied after the built-in rules; implies Redact
+	Templates   PathTemplates // empty templates use DefaultPathTemplates
+
+	FullRebuild bool // ignore the manifest and rewrite every conversation
+	Staging     bool // build the run next to the output directory and swap it into place on success
+	Resume      bool // continue an interrupted run from its checkpoint
+
+	Workers       int // workers converting conversations (default parser.DefaultConversationWorkers)
+	RenderWorkers int // workers rendering markdown (default renderer.DefaultWorkers)
+
+	Reproducible bool      // record SourceDate instead of the current time in generated files
+	SourceDate   time.Time // default: the Unix epoch; see utils.SourceDateEpoch
+
+	BuildInfo models.ToolInfo // recorded in the transformation report
+
+	// Logger receives the run's log messages (default slog.Default()). Warnings
+	// logged during a run are also collected for the transformation report.
+	Logger *slog.Logger
+}
+
+// withDefaults returns the options with empty fields set to their defaults
+func (o Options) withDefaults() Options {
+	if o.MediaMode == "" {
+		o.MediaMode = MediaModeReference
+	}
+	if o.Logger == nil {
+		o.Logger = slog.Default()
+	}
+	if o.Reproducible && o.SourceDate.IsZero() {
+		o.SourceDate = time.Unix(0, 0).UTC()
+	}
+
+	defaults := DefaultPathTemplates()
+	if o.Templates.Conversation == "" {
+		o.Templates.Conversation = defaults.Conversation
+	}
+	if o.Templates.ProjectConversation == "" {
+		o.Templates.ProjectConversation = defaults.ProjectConversation
+	}
+	if o.Templates.Project == "" {
+		o.Templates.Project = defaults.Project
+	}
+	if o.Templates.Media == "" {
+		o.Templates.Media = defaults.Media
+	}
+	return o
+}
+
+// Validate checks that the options describe a run that can be carried out
+func (o Options) Validate() error {
+	o = o.withDefaults()
+
+	if o.InputPath == "" && o.InputFS == nil {
+		return fmt.Errorf("an input path or file system is required")
+	}
+	if o.OutputPath == "" && o.Sink == nil && o.Exporter == nil {
+		return fmt.Errorf("an output path, sink or exporter is required")
+	}
+	if o.Exporter != nil && (o.Sink != nil || o.Staging || o.Resume) {
+		return fmt.Errorf("exports cannot be combined with sinks, staging or resuming")
+	}
+	if o.OutputPath == "" && (o.Resume || o.Staging) {
+		return fmt.Errorf("resuming and staging require an output path")
+	}
+
+	switch o.MediaMode {
+	case MediaModeReference, MediaModeCopy, MediaModeHardlink, MediaModeSymlink:
+	default:
+		return fmt.Errorf("invalid media mode %q (expected one of %s)", o.MediaMode, strings.Join(ValidMediaModes, ", "))
+	}
+	if o.ContentAddressedMedia && o.MediaMode == MediaModeReference {
+		return fmt.Errorf("content-addressed media requires a media mode other than %s", MediaModeReference)
+	}
+	if o.ClaudeOnly && o.ChatGPTOnly {
+		return fmt.Errorf("cannot process only Claude and only ChatGPT conversations at once")
+	}
+	if o.Workers < 0 || o.RenderWorkers < 0 {
+		return fmt.Errorf("worker counts cannot be negative")
+	}
+
+	return o.Templates.Validate()
+}
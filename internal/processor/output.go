@@ -0,0 +1,48 @@
+package processor
+
+import (
+	"io/fs"
+	"path/filepath"
+
+	"github.com/oisee/chat-transformer/internal/sink"
+)
+
+// createOutput starts writing the output file at relPath, relative to the output root
+func (p *Processor) createOutput(relPath string) (sink.File, error) {
+	return p.output.Create(filepath.ToSlash(relPath))
+}
+
+// writeOutput writes data to the output file at relPath
+func (p *Processor) writeOutput(relPath string, data []byte) error {
+	file, err := p.createOutput(relPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+	return file.Commit()
+}
+
+// readOutput reads the output file at relPath, written by this or an earlier run
+func (p *Processor) readOutput(relPath string) ([]byte, error) {
+	return fs.ReadFile(p.output, filepath.ToSlash(relPath))
+}
+
+// statOutput describes the output file at relPath
+func (p *Processor) statOutput(relPath string) (fs.FileInfo, error) {
+	return fs.Stat(p.output, filepath.ToSlash(relPath))
+}
+
+// outputExists reports whether the output file at relPath exists
+func (p *Processor) outputExists(relPath string) bool {
+	_, err := p.statOutput(relPath)
+	return err == nil
+}
+
+// removeOutput deletes the output file at relPath if it exists
+func (p *Processor) removeOutput(relPath string) error {
+	return p.output.Remove(filepath.ToSlash(relPath))
+}
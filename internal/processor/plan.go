@@ -0,0 +1,518 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/oisee/chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/renderer"
+	"github.com/oisee/chat-transformer/internal/utils"
+)
+
+// Plan parses the exports and works out what a run would write, without
+// creating or modifying anything in the output directory
+func (p *Processor) Plan(ctx context.Context) (*models.Plan, error) {
+	p.loadManifest()
+
+	plan := &models.Plan{
+		GeneratedAt: p.now(),
+		InputPath:   p.input.Dir,
+		OutputPath:  p.outputPath,
+		MediaMode:   p.mediaMode,
+		Conversations: models.PlanCounts{
+			ByPlatform: make(map[string]int),
+			ByProject:  make(map[string]int),
+			ByMonth:    make(map[string]int),
+		},
+	}
+
+	if !p.chatgptOnly {
+		if err := p.planClaude(ctx, plan); err != nil {
+			p.logger.Warn("Claude planning failed", "error", err)
+		}
+	}
+	if !p.claudeOnly {
+		if err := p.planChatGPT(ctx, plan); err != nil {
+			p.logger.Warn("ChatGPT planning failed", "error", err)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p.planGeneratedFiles(plan)
+
+	sort.Slice(plan.Files, func(i, j int) bool {
+		return plan.Files[i].Path < plan.Files[j].Path
+	})
+	sort.Slice(plan.Media, func(i, j int) bool {
+		return plan.Media[i].Path < plan.Media[j].Path
+	})
+
+	return plan, nil
+}
+
+// planClaude plans the Claude projects and conversations
+func (p *Processor) planClaude(ctx context.Context, plan *models.Plan) error {
+	projects, err := p.claudeParser.ParseProjects()
+	if err != nil {
+		p.logger.Warn("failed to load Claude projects", "error", err)
+		projects = []models.ClaudeProject{}
+	}
+
+	selected, err := p.selectClaudeProjects(ctx, projects)
+	if err != nil {
+		return err
+	}
+
+	projectMap := make(map[string]models.ClaudeProject)
+	for _, project := range projects {
+		projectMap[project.UUID] = project
+		if !p.projectSelected(project, selected) {
+			continue
+		}
+
+		projectDir := p.projectDir(project)
+		p.planFile(plan, filepath.Join(projectDir, "project.json"), project.UUID, encodedSize(project), "")
+		for _, doc := range project.Docs {
+			docPath := filepath.Join(projectDir, "documents", utils.SanitizeFilename(doc.Filename)+".md")
+			p.planFile(plan, docPath, project.UUID, int64(len(documentContent(doc))), "")
+		}
+		if p.renderMarkdown {
+			var size byteCounter
+			renderer.RenderProject(&size, project)
+			p.planFile(plan, renderer.MarkdownPath(filepath.Join(projectDir, "project.json")), project.UUID, int64(size), "")
+		}
+	}
+	p.planFile(plan, filepath.Join("claude", "media", "media_info.json"), "", encodedSize(emptyMediaInfo()), "")
+
+	return p.claudeParser.ParseConversations(ctx, projectMap, func(claude models.ClaudeConversation, conv models.Conversation) error {
+		if !p.filter.Matches(conv) {
+			return nil
+		}
+		p.planConversation(plan, &conv, claude.ProjectUUID, sourceHash(claude, conv.Metadata.Project))
+		return nil
+	})
+}
+
+// planChatGPT plans the ChatGPT media and conversations
+func (p *Processor) planChatGPT(ctx context.Context, plan *models.Plan) error {
+	mediaInfo, err := p.chatgptParser.GetMediaFiles()
+	if err == nil {
+		err = p.selectChatGPTMedia(ctx, mediaInfo)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	if err != nil {
+		p.logger.Warn("failed to scan media files", "error", err)
+		mediaInfo = nil
+	}
+
+	if mediaInfo != nil && p.copyMedia {
+		p.planMedia(plan, mediaInfo)
+	}
+
+	err = p.chatgptParser.ParseConversations(ctx, func(chatgpt models.ChatGPTConversation, conv models.Conversation) error {
+		if !p.filter.Matches(conv) {
+			return nil
+		}
+		if mediaInfo != nil {
+			p.linkAudioClips(&conv, mediaInfo)
+		}
+		p.planConversation(plan, &conv, "", sourceHash(chatgpt, audioClipsOf(conv)))
+		p.recordDalleGenerations(chatgpt, conv.Metadata)
+		if p.gallery {
+			p.recordImageReferences(chatgpt, conv.Metadata)
+		}
+		return nil
+	})
+	if ctx.Err() != nil {
+		return err
+	}
+
+	if mediaInfo != nil {
+		p.planChatGPTMediaFiles(plan, mediaInfo)
+	}
+	return err
+}
+
+// planChatGPTMediaFiles plans the media info, DALL-E catalog, thumbnails and
+// gallery written once all ChatGPT conversations are known
+func (p *Processor) planChatGPTMediaFiles(plan *models.Plan, mediaInfo *models.ChatGPTMediaInfo) {
+	mediaDir := filepath.Join("chatgpt", "media")
+
+	relativeMediaInfo := p.convertToRelativePaths(mediaInfo)
+	p.attachAudioClips(relativeMediaInfo)
+	// Placing media records how each file was placed, which is only known afterwards
+	note := ""
+	if p.copyMedia {
+		note = "estimated"
+	}
+	p.planFile(plan, filepath.Join(mediaDir, "media_info.json"), "", encodedSize(*relativeMediaInfo), note)
+
+	if catalog, _ := p.dalleCatalog(mediaInfo); len(catalog.Media) > 0 {
+		var size byteCounter
+		writeDalleCatalogMarkdown(&size, catalog)
+		p.planFile(plan, filepath.Join(mediaDir, "dalle_catalog.json"), "", encodedSize(catalog), "")
+		p.planFile(plan, filepath.Join(mediaDir, "dalle_catalog.md"), "", int64(size), "")
+	}
+
+	if !p.gallery {
+		return
+	}
+
+	groups := []struct {
+		folder string
+		files  []models.MediaFile
+	}{
+		{"images", mediaInfo.Images},
+		{"dalle-generations", mediaInfo.DalleGenerations},
+		{"user-uploads", mediaInfo.UserUploads},
+	}
+	for _, group := range groups {
+		for _, file := range group.files {
+			relPath, ok := p.thumbnailPath(group.folder, file)
+			if !ok {
+				continue
+			}
+			p.thumbnails[file.Path] = relPath
+
+			thumbPath := filepath.Join(mediaDir, relPath)
+			if info, err := p.statOutput(thumbPath); err == nil && !info.ModTime().Before(file.Modified) {
+				p.planUnchangedFile(plan, thumbPath, p.getRelativeMediaPath(file.Path))
+				continue
+			}
+			p.planFile(plan, thumbPath, p.getRelativeMediaPath(file.Path), 0, "size known once encoded")
+		}
+	}
+
+	var size byteCounter
+	if _, err := p.writeGallery(&size, mediaInfo); err == nil {
+		p.planFile(plan, filepath.Join(mediaDir, "gallery.html"), "", int64(size), "")
+	}
+}
+
+// planGeneratedFiles plans the READMEs, indexes, manifest and report written at
+// the end of a run
+func (p *Processor) planGeneratedFiles(plan *models.Plan) {
+	for path, content := range readmeFiles() {
+		p.planFile(plan, filepath.FromSlash(path), "", int64(len(content)), "")
+	}
+	for path, size := range p.indexer.PlanIndexes() {
+		p.planFile(plan, filepath.FromSlash(path), "", size, "")
+	}
+
+	p.manifestMutex.Lock()
+	manifestSize := encodedSize(p.manifest)
+	p.manifestMutex.Unlock()
+	p.planFile(plan, manifestFile, "", manifestSize, "")
+
+	// Timings, warnings and input hashes are only known after the run
+	report := models.TransformationReport{
+		Tool:            p.buildInfo,
+		Platforms:       make(map[string]models.ReportStatistics),
+		Projects:        plan.Conversations.ByProject,
+		Inputs:          []models.InputFingerprint{},
+		Skipped:         []models.ReportItem{},
+		Failed:          []models.ReportItem{},
+		Warnings:        []string{},
+		OutputStructure: "see README.md for details",
+	}
+	for platform, count := range plan.Conversations.ByPlatform {
+		report.Platforms[platform] = models.ReportStatistics{Conversations: count}
+	}
+	report.Statistics.Conversations = plan.Totals.Conversations
+	report.Statistics.Collisions = plan.Totals.Collisions
+	p.planFile(plan, reportFile, "", encodedSize(report), "estimated")
+}
+
+// planConversation counts a conversation and plans its output file and markdown,
+// recording it in the indexes and the manifest the run would write
+func (p *Processor) planConversation(plan *models.Plan, conv *models.Conversation, projectID, hash string) {
+	metadata := conv.Metadata
+	wanted := p.conversationPath(metadata, projectID)
+	relPath := p.claimOutputPath(metadata.ID, wanted)
+	conv.Metadata.FilePath = relPath
+	unchanged := p.isUnchanged(metadata.ID, hash, relPath)
+	p.indexer.AddConversation(conv.Metadata)
+
+	var markdownSize byteCounter
+	markdownPath := ""
+	if p.renderMarkdown {
+		markdownPath = renderer.MarkdownPath(relPath)
+		p.renderer.RenderConversation(&markdownSize, *conv, markdownPath)
+	}
+
+	p.manifestMutex.Lock()
+	defer p.manifestMutex.Unlock()
+
+	plan.Conversations.ByPlatform[metadata.Platform]++
+	if metadata.Project != "" {
+		plan.Conversations.ByProject[metadata.Platform+"/"+metadata.Project]++
+	}
+	plan.Conversations.ByMonth[metadata.Platform+"/"+metadata.CreatedDate.Format("2006-01")]++
+	plan.Totals.Conversations++
+
+	switch {
+	case relPath != wanted:
+		size := encodedSize(conv)
+		plan.Files = append(plan.Files, models.PlannedFile{
+			Path:   filepath.ToSlash(relPath),
+			Source: metadata.ID,
+			Action: "collision",
+			Bytes:  size,
+			Note:   "would overwrite " + filepath.ToSlash(wanted),
+		})
+		plan.Totals.Collisions++
+		plan.Totals.Bytes += size
+	case unchanged:
+		plan.Files = append(plan.Files, models.PlannedFile{
+			Path:   filepath.ToSlash(relPath),
+			Source: metadata.ID,
+			Action: "unchanged",
+		})
+		plan.Totals.Unchanged++
+	default:
+		p.appendPlannedFile(plan, relPath, metadata.ID, encodedSize(conv), "")
+	}
+	if !unchanged {
+		// The dry run never saves the manifest; the entry only sizes the one the run writes
+		p.manifest.Conversations[metadata.ID] = models.ManifestEntry{
+			SourceHash:  hash,
+			OutputPath:  relPath,
+			ProcessedAt: p.now(),
+		}
+	}
+
+	switch {
+	case markdownPath == "":
+	case unchanged && p.outputExists(markdownPath):
+		plan.Files = append(plan.Files, models.PlannedFile{
+			Path:   filepath.ToSlash(markdownPath),
+			Source: metadata.ID,
+			Action: "unchanged",
+		})
+		plan.Totals.Unchanged++
+	default:
+		p.appendPlannedFile(plan, markdownPath, metadata.ID, int64(markdownSize), "")
+	}
+}
+
+// planFile plans a file that is rewritten on every run
+func (p *Processor) planFile(plan *models.Plan, relPath, source string, size int64, note string) {
+	p.manifestMutex.Lock()
+	defer p.manifestMutex.Unlock()
+	p.appendPlannedFile(plan, relPath, source, size, note)
+}
+
+// planUnchangedFile plans a file the run leaves as it is
+func (p *Processor) planUnchangedFile(plan *models.Plan, relPath, source string) {
+	p.manifestMutex.Lock()
+	defer p.manifestMutex.Unlock()
+
+	plan.Files = append(plan.Files, models.PlannedFile{
+		Path:   filepath.ToSlash(relPath),
+		Source: source,
+		Action: "unchanged",
+	})
+	plan.Totals.Unchanged++
+}
+
+// appendPlannedFile adds a created or overwritten file to the plan. Callers hold manifestMutex.
+func (p *Processor) appendPlannedFile(plan *models.Plan, relPath, source string, size int64, note string) {
+	action := "create"
+	if p.outputExists(relPath) {
+		action = "overwrite"
+		plan.Totals.Overwrite++
+	} else {
+		plan.Totals.Create++
+	}
+
+	plan.Files = append(plan.Files, models.PlannedFile{
+		Path:   filepath.ToSlash(relPath),
+		Source: source,
+		Action: action,
+		Bytes:  size,
+		Note:   note,
+	})
+	plan.Totals.Bytes += size
+}
+
+// planMedia plans the media files that would be placed in the output directory
+func (p *Processor) planMedia(plan *models.Plan, mediaInfo *models.ChatGPTMediaInfo) {
+	mediaBase := filepath.Join("chatgpt", "media")
+
+	groups := []struct {
+		folder string
+		files  []models.MediaFile
+	}{
+		{"images", mediaInfo.Images},
+		{"dalle-generations", mediaInfo.DalleGenerations},
+		{"user-uploads", mediaInfo.UserUploads},
+		{"files", mediaInfo.Files},
+	}
+	for _, audioConv := range mediaInfo.AudioConversations {
+		groups = append(groups, struct {
+			folder string
+			files  []models.MediaFile
+		}{filepath.Join("audio-conversations", audioConv.ConversationID), audioConv.AudioFiles})
+	}
+
+	// Objects already in the content-addressed store are not placed again
+	stored := make(map[string]bool)
+	if p.contentAddressed {
+		if store, err := openMediaStore(p.output, mediaBase, p.input); err == nil {
+			for hash, object := range store.index.Objects {
+				if p.outputExists(filepath.Join(mediaBase, object.Path)) {
+					stored[hash] = true
+				}
+			}
+		}
+	}
+
+	for _, group := range groups {
+		for _, file := range group.files {
+			relPath := p.mediaPath(group.folder, file.Name)
+			action := "create"
+
+			if p.contentAddressed {
+				hash, _, err := hashFile(p.input, file.Path)
+				if err != nil {
+					p.logger.Warn("failed to hash media file", "path", file.Path, "error", err)
+					continue
+				}
+				relPath = filepath.Join("chatgpt", "media", objectPath(hash, file.Name))
+				if stored[hash] {
+					action = "deduplicated"
+				}
+				stored[hash] = true
+			} else if p.outputExists(relPath) {
+				action = "overwrite"
+			}
+
+			planned := models.PlannedFile{
+				Path:   filepath.ToSlash(relPath),
+				Source: p.getRelativeMediaPath(file.Path),
+				Action: action,
+				Bytes:  file.Size,
+			}
+			plan.Media = append(plan.Media, planned)
+
+			if action == "deduplicated" {
+				continue
+			}
+			plan.Totals.MediaFiles++
+			if p.mediaMode == MediaModeCopy {
+				plan.Totals.MediaBytes += file.Size
+				plan.Totals.Bytes += file.Size
+			}
+		}
+	}
+
+	for path, content := range mediaREADMEFiles() {
+		p.planFile(plan, filepath.Join("chatgpt", "media", filepath.FromSlash(path)), "", int64(len(content)), "")
+	}
+}
+
+// PrintPlan prints a human-readable summary of a plan
+func PrintPlan(plan *models.Plan) {
+	fmt.Println("\nDry run: nothing was written")
+	fmt.Printf("Output folder: %s\n", plan.OutputPath)
+
+	fmt.Printf("\nConversations: %d\n", plan.Totals.Conversations)
+	printCounts("By platform", plan.Conversations.ByPlatform)
+	printCounts("By project", plan.Conversations.ByProject)
+	printCounts("By month", plan.Conversations.ByMonth)
+
+	fmt.Printf("\nFiles: %d to create, %d to overwrite, %d unchanged, %d colliding\n",
+		plan.Totals.Create, plan.Totals.Overwrite, plan.Totals.Unchanged, plan.Totals.Collisions)
+	for _, file := range plan.Files {
+		if file.Action == "collision" {
+			fmt.Printf("  collision: %s (%s)\n", file.Path, file.Note)
+		}
+	}
+
+	if len(plan.Media) > 0 {
+		fmt.Printf("Media (%s): %d files to place, %s copied\n",
+			plan.MediaMode, plan.Totals.MediaFiles, formatBytes(plan.Totals.MediaBytes))
+	}
+	fmt.Printf("Total: %s to write\n", formatBytes(plan.Totals.Bytes))
+}
+
+// SavePlan writes a plan as JSON
+func SavePlan(plan *models.Plan, path string) error {
+	file, err := utils.CreateAtomic(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(plan); err != nil {
+		return err
+	}
+	return file.Commit()
+}
+
+// printCounts prints counts sorted by key
+func printCounts(label string, counts map[string]int) {
+	if len(counts) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s %d", key, counts[key]))
+	}
+	fmt.Printf("  %s: %s\n", label, strings.Join(parts, ", "))
+}
+
+// byteCounter is a writer that counts the bytes written to it
+type byteCounter int64
+
+func (c *byteCounter) Write(b []byte) (int, error) {
+	*c += byteCounter(len(b))
+	return len(b), nil
+}
+
+// encodedSize returns the size of a value written as indented JSON
+func encodedSize(v interface{}) int64 {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return 0
+	}
+	return int64(len(data)) + 1 // the encoder adds a trailing newline
+}
+
+// fileExists reports whether a file exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// formatBytes formats a byte count for display
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -1,138 +1,328 @@
 package processor
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"os"
+	"log/slog"
 	"path/filepath"
+	"sync"
 	"time"
 
-	"chat-transformer/internal/indexer"
-	"chat-transformer/internal/models"
-	"chat-transformer/internal/parser"
-	"chat-transformer/internal/renderer"
-	"chat-transformer/internal/utils"
+	"github.com/oisee/chat-transformer/internal/export"
+	"github.com/oisee/chat-transformer/internal/indexer"
+	"github.com/oisee/chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/parser"
+	"github.com/oisee/chat-transformer/internal/redact"
+	"github.com/oisee/chat-transformer/internal/renderer"
+	"github.com/oisee/chat-transformer/internal/sink"
+	"github.com/oisee/chat-transformer/internal/utils"
 )
 
 // Processor handles the main transformation logic
 type Processor struct {
-	inputPath      string
-	outputPath     string
-	parser         *parser.Parser
-	chatgptParser  *parser.ChatGPTParser
-	indexer        *indexer.Indexer
-	renderer       *renderer.MarkdownRenderer
-	copyMedia      bool
-	claudeOnly     bool
-	chatgptOnly    bool
-	renderMarkdown bool
+	input            parser.Input
+	outputPath       string          // directory of the output; empty when it is built in memory for the sink
+	output           sink.Tree       // the output being built, at outputPath or in memory
+	sink             sink.Sink       // receives the output after a successful run
+	exporter         export.Exporter // receives the conversations instead of the expanded output
+	claudeParser     *parser.ClaudeParser
+	chatgptParser    *parser.ChatGPTParser
+	indexer          *indexer.Indexer
+	renderer         *renderer.MarkdownRenderer
+	copyMedia        bool
+	mediaMode        string
+	contentAddressed bool
+	claudeOnly       bool
+	chatgptOnly      bool
+	renderMarkdown   bool
+	gallery          bool
+	fullRebuild      bool
+	staging          bool
+	filter           Filter
+	templates        PathTemplates
+	incremental      bool // skip conversations the manifest shows as unchanged
+	resume           bool
+	renderWorkers    int
+	reproducible     bool // record sourceDate instead of the current time in generated files
+	sourceDate       time.Time
+
+	manifestMutex   sync.Mutex // protects manifest, manifestOutputs and lastCheckpoint
+	manifest        models.Manifest
+	manifestOutputs map[string]int // manifest output path -> conversations written there
+	lastCheckpoint  time.Time
+
+	outputMutex   sync.Mutex        // protects outputPaths, collisions and the project names
+	outputPaths   map[string]string // conversation file path -> conversation ID
+	projectOwners map[string]string // {project} value -> Claude project ID
+	projectNames  map[string]string // Claude project ID -> {project} value
+	collisions    int
+
+	projectFiles []string // project.json files written by this run
+
+	redactor          *redact.Redactor // nil unless conversations are redacted
+	redactionMutex    sync.Mutex       // protects redactions and projectRedactions
+	redactions        []models.RedactedConversation
+	projectRedactions []models.RedactedConversation
+
+	buildInfo  models.ToolInfo
+	baseLogger *slog.Logger                 // the logger of the options
+	logger     *slog.Logger                 // baseLogger, collecting warnings for the report while a run is in progress
+	report     *runReport                   // collects the transformation report of the current run
+	written    *models.TransformationReport // the report written by the last completed run
+
+	mediaMutex       sync.Mutex // protects dalleGenerations, audioClips and imageRefs
+	dalleGenerations []dalleRecord
+	audioClips       map[string][]models.AudioClip // conversation ID -> linked clips
+	imageRefs        map[string]conversationRef    // image file ID -> referencing conversation
+	thumbnails       map[string]string             // source image path -> thumbnail path
+	mediaModeCounts  map[string]int                // media mode actually used -> file count
 }
 
-// New creates a new processor instance
-func New(inputPath, outputPath string) *Processor {
-	return &Processor{
-		inputPath:      inputPath,
-		outputPath:     outputPath,
-		parser:         parser.New(inputPath),
-		chatgptParser:  parser.NewChatGPTParser(inputPath),
-		indexer:        indexer.New(outputPath),
-		renderer:       renderer.New(outputPath),
-		copyMedia:      false, // default to not copying media
-		claudeOnly:     false,
-		chatgptOnly:    false,
-		renderMarkdown: false,
+// New creates a processor for a run with the given options
+func New(opts Options) (*Processor, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	opts = opts.withDefaults()
+
+	input := parser.DirInput(opts.InputPath)
+	if opts.InputFS != nil {
+		input = parser.Input{FS: opts.InputFS}
+	}
+
+	// Without an output directory the run is built in memory for the sink
+	output := sink.NewMemoryTree()
+	if opts.OutputPath != "" {
+		output = sink.NewDirTree(opts.OutputPath)
+	}
+
+	p := &Processor{
+		input:            input,
+		outputPath:       opts.OutputPath,
+		output:           output,
+		sink:             opts.Sink,
+		exporter:         opts.Exporter,
+		claudeParser:     parser.NewClaudeParser(input),
+		chatgptParser:    parser.NewChatGPTParser(input),
+		indexer:          indexer.New(output),
+		renderer:         renderer.New(output),
+		copyMedia:        opts.MediaMode != MediaModeReference,
+		mediaMode:        opts.MediaMode,
+		contentAddressed: opts.ContentAddressedMedia,
+		mediaModeCounts:  make(map[string]int),
+		templates:        opts.Templates,
+		claudeOnly:       opts.ClaudeOnly,
+		chatgptOnly:      opts.ChatGPTOnly,
+		renderMarkdown:   opts.RenderMarkdown,
+		gallery:          opts.Gallery,
+		fullRebuild:      opts.FullRebuild,
+		staging:          opts.Staging,
+		resume:           opts.Resume,
+		filter:           opts.Filter,
+		renderWorkers:    opts.RenderWorkers,
+		reproducible:     opts.Reproducible,
+		sourceDate:       opts.SourceDate,
+		buildInfo:        opts.BuildInfo,
+		baseLogger:       opts.Logger,
+		audioClips:       make(map[string][]models.AudioClip),
+		imageRefs:        make(map[string]conversationRef),
+		thumbnails:       make(map[string]string),
+		outputPaths:      make(map[string]string),
+		projectOwners:    make(map[string]string),
+		projectNames:     make(map[string]string),
+	}
+
+	if opts.Redact || len(opts.RedactRules) > 0 {
+		p.redactor = redact.New(append(redact.BuiltinRules(), opts.RedactRules...))
+	}
+
+	p.setLogger(opts.Logger)
+
+	// Zero worker counts keep the parser and renderer defaults
+	p.claudeParser.SetWorkers(opts.Workers)
+	p.chatgptParser.SetWorkers(opts.Workers)
+	p.renderer.SetWorkers(opts.RenderWorkers)
+	if p.reproducible {
+		p.indexer.SetTimestamp(p.sourceDate)
+	}
+	return p, nil
+}
+
+// now returns the time recorded in generated files
+func (p *Processor) now() time.Time {
+	if p.reproducible {
+		return p.sourceDate
 	}
+	return time.Now()
 }
 
-// SetCopyMedia sets whether to copy media files
-func (p *Processor) SetCopyMedia(copy bool) {
-	p.copyMedia = copy
+// Run executes the transformation process. When ctx is cancelled, the work in
+// flight is finished, a checkpoint is saved and the context's error is returned.
+func (p *Processor) Run(ctx context.Context) error {
+	if p.exporter != nil {
+		return p.runExport(ctx)
+	}
+
+	var err error
+	if p.staging {
+		err = p.runStaged(ctx)
+	} else {
+		err = p.run(ctx)
+	}
+	if err != nil || p.sink == nil {
+		return err
+	}
+	return p.exportOutput()
 }
 
-// SetPlatformModes sets which platforms to process
-func (p *Processor) SetPlatformModes(claudeOnly, chatgptOnly bool) {
-	p.claudeOnly = claudeOnly
-	p.chatgptOnly = chatgptOnly
+// exportOutput writes the finished output to the sink
+func (p *Processor) exportOutput() error {
+	p.logger.Info("Writing output to sink...")
+
+	// Archives record the source date instead of the time files were written
+	var modTime time.Time
+	if p.reproducible {
+		modTime = p.sourceDate
+	}
+
+	if err := sink.Export(p.output, p.sink, modTime); err != nil {
+		return fmt.Errorf("failed to export output: %w", err)
+	}
+	if err := p.sink.Close(); err != nil {
+		return fmt.Errorf("failed to finish output: %w", err)
+	}
+	p.logger.Info("Output written to sink")
+	return nil
 }
 
-// SetRenderMarkdown sets whether to render conversations to markdown
-func (p *Processor) SetRenderMarkdown(render bool) {
-	p.renderMarkdown = render
+// setLogger makes logger receive the log messages of the processor and the
+// parsers, indexer and renderer it uses
+func (p *Processor) setLogger(logger *slog.Logger) {
+	p.logger = logger
+	p.claudeParser.SetLogger(logger)
+	p.chatgptParser.SetLogger(logger)
+	p.indexer.SetLogger(logger)
+	p.renderer.SetLogger(logger)
 }
 
-// Run executes the transformation process
-func (p *Processor) Run() error {
-	fmt.Println("Starting chat export transformation...")
+// run transforms the exports into the current output directory
+func (p *Processor) run(ctx context.Context) error {
+	p.logger.Info("Starting chat export transformation...")
+	p.report = newRunReport(p.baseLogger)
+	p.setLogger(p.report.logger)
+	defer p.setLogger(p.baseLogger)
 
 	// Create output directory structure
 	if err := p.createDirectoryStructure(); err != nil {
 		return fmt.Errorf("failed to create directory structure: %w", err)
 	}
 
-	var projectStats, claudeStats, chatgptStats ProcessingStats
+	// Load the manifest of the previous run to skip unchanged conversations, and
+	// the checkpoint of an interrupted run when resuming
+	p.loadManifest()
+	p.loadCheckpoint()
 
 	// Process Claude exports (unless ChatGPT-only mode)
 	if !p.chatgptOnly {
-		fmt.Println("Processing Claude projects...")
-		var err error
-		projectStats, err = p.processClaudeProjects()
+		p.logger.Info("Processing Claude projects...")
+		start := time.Now()
+		projectStats, err := p.processClaudeProjects(ctx)
+		p.report.recordPhase("claude projects", start)
+		p.report.recordStats("claude", projectStats)
 		if err != nil {
-			fmt.Printf("Warning: Claude project processing failed: %v\n", err)
+			p.logger.Warn("Claude project processing failed", "error", err)
 		} else {
-			fmt.Printf("✓ Processed %d Claude projects\n", projectStats.ProjectCount)
+			p.logger.Info("Processed Claude projects", "count", projectStats.ProjectCount)
 		}
 
-		fmt.Println("Processing Claude conversations...")
-		claudeStats, err = p.processClaudeConversations()
+		p.logger.Info("Processing Claude conversations...")
+		start = time.Now()
+		claudeStats, err := p.processClaudeConversations(ctx)
+		p.report.recordPhase("claude conversations", start)
+		p.report.recordStats("claude", claudeStats)
+		if ctx.Err() != nil {
+			return p.interrupted(ctx.Err())
+		}
 		if err != nil {
-			fmt.Printf("Warning: Claude processing failed: %v\n", err)
+			p.logger.Warn("Claude processing failed", "error", err)
 		} else {
-			fmt.Printf("✓ Processed %d Claude conversations\n", claudeStats.ConversationCount)
+			p.logger.Info("Processed Claude conversations", "count", claudeStats.ConversationCount,
+				"unchanged", claudeStats.UnchangedCount, "filtered", claudeStats.FilteredCount)
 		}
 	} else {
-		fmt.Println("Skipping Claude processing (ChatGPT-only mode)")
+		p.logger.Info("Skipping Claude processing (ChatGPT-only mode)")
 	}
 
 	// Process ChatGPT exports (unless Claude-only mode)
 	if !p.claudeOnly {
-		fmt.Println("Processing ChatGPT conversations...")
-		var err error
-		chatgptStats, err = p.processChatGPTConversations()
+		p.logger.Info("Processing ChatGPT conversations...")
+		start := time.Now()
+		chatgptStats, err := p.processChatGPTConversations(ctx)
+		p.report.recordPhase("chatgpt conversations", start)
+		p.report.recordStats("chatgpt", chatgptStats)
+		if ctx.Err() != nil {
+			return p.interrupted(ctx.Err())
+		}
 		if err != nil {
-			fmt.Printf("Warning: ChatGPT processing failed: %v\n", err)
+			p.logger.Warn("ChatGPT processing failed", "error", err)
 		} else {
-			fmt.Printf("✓ Processed %d ChatGPT conversations\n", chatgptStats.ConversationCount)
+			p.logger.Info("Processed ChatGPT conversations", "count", chatgptStats.ConversationCount,
+				"unchanged", chatgptStats.UnchangedCount, "filtered", chatgptStats.FilteredCount)
 		}
 	} else {
-		fmt.Println("Skipping ChatGPT processing (Claude-only mode)")
+		p.logger.Info("Skipping ChatGPT processing (Claude-only mode)")
+	}
+
+	if p.collisions > 0 {
+		p.logger.Warn("conversations had colliding filenames and were saved under their full ID", "count", p.collisions)
 	}
 
 	// Generate indexes
-	fmt.Println("Generating search indexes...")
+	p.logger.Info("Generating search indexes...")
+	start := time.Now()
 	if err := p.indexer.GenerateIndexes(); err != nil {
-		return fmt.Errorf("failed to generate indexes: %w", err)
+		return p.interrupted(fmt.Errorf("failed to generate indexes: %w", err))
 	}
-	fmt.Println("✓ Generated search indexes")
+	p.report.recordPhase("indexes", start)
+	p.logger.Info("Generated search indexes")
 
 	// Render to markdown if requested
 	if p.renderMarkdown {
-		if err := p.renderer.RenderAll(); err != nil {
-			fmt.Printf("Warning: markdown rendering failed: %v\n", err)
+		start = time.Now()
+		p.renderer.SetFiles(p.conversationFiles(), p.projectFiles)
+		if err := p.renderer.RenderAll(ctx); err != nil {
+			if ctx.Err() != nil {
+				return p.interrupted(ctx.Err())
+			}
+			p.logger.Warn("markdown rendering failed", "error", err)
 		}
+		p.report.recordPhase("markdown", start)
 	}
 
-	// Generate report
-	totalStats := ProcessingStats{
-		ConversationCount: claudeStats.ConversationCount + chatgptStats.ConversationCount,
-		MessageCount:      claudeStats.MessageCount + chatgptStats.MessageCount,
-		MediaCount:        claudeStats.MediaCount + chatgptStats.MediaCount,
-		ProjectCount:      projectStats.ProjectCount,
-		StartTime:         time.Now(), // This should be set at the beginning
-		EndTime:           time.Now(),
+	if p.redactor != nil {
+		p.logRedactions()
+		if err := p.saveRedactionReport(); err != nil {
+			p.logger.Warn("failed to write redaction report", "error", err)
+		}
+	} else {
+		// The conversations of an earlier redacting run were just rewritten unredacted
+		p.removeOutput(redactionReportFile)
 	}
 
-	if err := p.generateReport(totalStats); err != nil {
-		fmt.Printf("Warning: failed to generate report: %v\n", err)
+	// Record what was processed for the next incremental run
+	start = time.Now()
+	if err := p.saveManifest(); err != nil {
+		p.logger.Warn("failed to save manifest", "error", err)
+	}
+	p.removeCheckpoint()
+	p.report.recordPhase("manifest", start)
+
+	// Generate report
+	if err := p.generateReport(); err != nil {
+		p.logger.Warn("failed to generate report", "error", err)
+	} else {
+		p.logger.Info("Wrote transformation report", p.report.counts()...)
 	}
 
 	return nil
@@ -141,11 +331,12 @@ func (p *Processor) Run() error {
 // ProcessingStats holds statistics about the transformation
 type ProcessingStats struct {
 	ConversationCount int
+	UnchangedCount    int // conversations skipped because their source did not change
+	FilteredCount     int // conversations not selected by the filter
 	MessageCount      int
+	FailedCount       int // conversations that could not be saved
 	MediaCount        int
 	ProjectCount      int
-	StartTime         time.Time
-	EndTime           time.Time
 }
 
 // createDirectoryStructure creates the output directory structure
@@ -163,8 +354,7 @@ func (p *Processor) createDirectoryStructure() error {
 	}
 
 	for _, dir := range dirs {
-		fullPath := filepath.Join(p.outputPath, dir)
-		if err := os.MkdirAll(fullPath, 0755); err != nil {
+		if err := p.output.MkdirAll(dir); err != nil {
 			return err
 		}
 	}
@@ -178,42 +368,43 @@ func (p *Processor) createDirectoryStructure() error {
 }
 
 // processClaudeProjects processes Claude project exports
-func (p *Processor) processClaudeProjects() (ProcessingStats, error) {
+func (p *Processor) processClaudeProjects(ctx context.Context) (ProcessingStats, error) {
 	stats := ProcessingStats{}
 
 	// Load projects
-	projects, err := p.parser.ParseClaudeProjects()
+	projects, err := p.claudeParser.ParseProjects()
 	if err != nil {
 		return stats, fmt.Errorf("failed to load Claude projects: %w", err)
 	}
 
+	// With a filter, skip the projects none of the selected conversations belong to
+	selected, err := p.selectClaudeProjects(ctx, projects)
+	if err != nil {
+		return stats, fmt.Errorf("failed to select Claude projects: %w", err)
+	}
+
 	// Process each project
 	for _, project := range projects {
-		// Create project directory
-		projectDir := filepath.Join(p.outputPath, "claude", "projects", utils.SanitizeFilename(project.Name))
-		if err := os.MkdirAll(projectDir, 0755); err != nil {
-			return stats, fmt.Errorf("failed to create project directory: %w", err)
+		if !p.projectSelected(project, selected) {
+			p.report.recordSkipped("project", project.Name, "did not match filters")
+			continue
 		}
 
+		p.redactProject(&project)
+
 		// Save project metadata
+		projectDir := p.projectDir(project)
 		projectPath := filepath.Join(projectDir, "project.json")
 		if err := p.saveProject(project, projectPath); err != nil {
 			return stats, fmt.Errorf("failed to save project %s: %w", project.Name, err)
 		}
+		p.projectFiles = append(p.projectFiles, projectPath)
 
 		// Save project documents
-		if len(project.Docs) > 0 {
-			docsDir := filepath.Join(projectDir, "documents")
-			if err := os.MkdirAll(docsDir, 0755); err != nil {
-				return stats, fmt.Errorf("failed to create documents directory: %w", err)
-			}
-
-			for _, doc := range project.Docs {
-				docFilename := utils.SanitizeFilename(doc.Filename) + ".md"
-				docPath := filepath.Join(docsDir, docFilename)
-				if err := p.saveDocument(doc, docPath); err != nil {
-					fmt.Printf("Warning: failed to save document %s: %v\n", doc.Filename, err)
-				}
+		for _, doc := range project.Docs {
+			docPath := filepath.Join(projectDir, "documents", utils.SanitizeFilename(doc.Filename)+".md")
+			if err := p.saveDocument(doc, docPath); err != nil {
+				p.report.recordFailure("document", doc.Filename, err)
 			}
 		}
 
@@ -221,84 +412,59 @@ func (p *Processor) processClaudeProjects() (ProcessingStats, error) {
 	}
 
 	// Create empty media info for Claude (for consistency)
-	claudeMediaInfo := models.ChatGPTMediaInfo{
+	mediaPath := filepath.Join("claude", "media", "media_info.json")
+	if err := p.saveMediaInfo(emptyMediaInfo(), mediaPath); err != nil {
+		p.logger.Warn("failed to save Claude media info", "path", mediaPath, "error", err)
+	}
+
+	return stats, nil
+}
+
+// emptyMediaInfo returns the media info written for Claude, which exports no media
+func emptyMediaInfo() models.ChatGPTMediaInfo {
+	return models.ChatGPTMediaInfo{
 		Images:             []models.MediaFile{},
 		DalleGenerations:   []models.MediaFile{},
 		UserUploads:        []models.MediaFile{},
+		Files:              []models.MediaFile{},
 		AudioConversations: []models.AudioConversation{},
 	}
-	mediaPath := filepath.Join(p.outputPath, "claude", "media", "media_info.json")
-	if err := p.saveMediaInfo(claudeMediaInfo, mediaPath); err != nil {
-		fmt.Printf("Warning: failed to save Claude media info: %v\n", err)
-	}
-
-	return stats, nil
 }
 
 // processClaudeConversations processes Claude conversation exports
-func (p *Processor) processClaudeConversations() (ProcessingStats, error) {
+func (p *Processor) processClaudeConversations(ctx context.Context) (ProcessingStats, error) {
 	stats := ProcessingStats{}
 
-	// Load projects first
-	projects, err := p.parser.ParseClaudeProjects()
-	if err != nil {
-		fmt.Printf("Warning: failed to load Claude projects: %v\n", err)
-		projects = []models.ClaudeProject{}
-	}
-
-	projectMap := make(map[string]models.ClaudeProject)
-	for _, project := range projects {
-		projectMap[project.UUID] = project
-	}
-
 	// Process conversations
-	err = p.parser.ParseClaudeConversations(func(claude models.ClaudeConversation) error {
-		conv := parser.ConvertClaudeToStandard(claude, projectMap)
-		
-		// Determine output path
-		var outputDir string
-		if conv.Metadata.Project != "" {
-			outputDir = filepath.Join(p.outputPath, "claude", "projects", utils.SanitizeFilename(conv.Metadata.Project))
-			if err := os.MkdirAll(outputDir, 0755); err != nil {
-				return err
-			}
-		} else {
-			year := conv.Metadata.CreatedDate.Format("2006")
-			month := conv.Metadata.CreatedDate.Format("01")
-			outputDir = filepath.Join(p.outputPath, "claude", "chats", year, month)
-			if err := os.MkdirAll(outputDir, 0755); err != nil {
-				return err
-			}
+	err := p.claudeParser.ParseConversations(ctx, p.claudeProjectMap(), func(claude models.ClaudeConversation, conv models.Conversation) error {
+		if !p.filter.Matches(conv) {
+			stats.FilteredCount++
+			p.report.recordSkipped("conversation", conv.Metadata.ID, "did not match filters")
+			return nil
 		}
+		p.redactConversation(&conv)
 
-		// Generate filename
-		filename := fmt.Sprintf("%s_%s.json",
-			conv.Metadata.CreatedDate.Format("2006-01-02"),
-			utils.SanitizeFilename(conv.Metadata.Title))
-		
-		outputPath := filepath.Join(outputDir, filename)
-		// Store relative path instead of full path
-		relPath, err := filepath.Rel(p.outputPath, outputPath)
-		if err != nil {
-			// Fallback to constructing relative path manually
-			if conv.Metadata.Project != "" {
-				relPath = filepath.Join("claude", "projects", utils.SanitizeFilename(conv.Metadata.Project), filename)
-			} else {
-				year := conv.Metadata.CreatedDate.Format("2006")
-				month := conv.Metadata.CreatedDate.Format("01")
-				relPath = filepath.Join("claude", "chats", year, month, filename)
-			}
-		}
+		// Determine output path
+		relPath := p.claimOutputPath(conv.Metadata.ID, p.conversationPath(conv.Metadata, claude.ProjectUUID))
 		conv.Metadata.FilePath = relPath
 
-		// Save conversation
-		if err := p.saveConversation(conv, outputPath); err != nil {
-			return err
+		// Save conversation unless the previous run already wrote it from the same source
+		hash := sourceHash(claude, conv.Metadata.Project)
+		if p.isUnchanged(conv.Metadata.ID, hash, relPath) {
+			stats.UnchangedCount++
+		} else {
+			if err := p.saveConversation(conv, relPath); err != nil {
+				stats.FailedCount++
+				p.report.recordFailure("conversation", conv.Metadata.ID, err)
+				return nil
+			}
+			p.recordConversation(conv.Metadata.ID, hash, relPath)
 		}
 
 		// Add to indexer
 		p.indexer.AddConversation(conv.Metadata)
 
+		p.report.recordProject(conv.Metadata)
 		stats.ConversationCount++
 		stats.MessageCount += len(conv.Messages)
 
@@ -308,96 +474,159 @@ func (p *Processor) processClaudeConversations() (ProcessingStats, error) {
 	return stats, err
 }
 
+// claudeProjectMap loads the Claude projects that conversations refer to, by UUID
+func (p *Processor) claudeProjectMap() map[string]models.ClaudeProject {
+	projects, err := p.claudeParser.ParseProjects()
+	if err != nil {
+		p.logger.Warn("failed to load Claude projects", "error", err)
+	}
+
+	projectMap := make(map[string]models.ClaudeProject)
+	for _, project := range projects {
+		projectMap[project.UUID] = project
+	}
+	return projectMap
+}
+
 // processChatGPTConversations processes ChatGPT conversation exports with enhanced parsing
-func (p *Processor) processChatGPTConversations() (ProcessingStats, error) {
+func (p *Processor) processChatGPTConversations(ctx context.Context) (ProcessingStats, error) {
 	stats := ProcessingStats{}
 
 	// Process user info first
 	user, err := p.chatgptParser.ParseUserInfo()
 	if err != nil {
-		fmt.Printf("Warning: failed to parse user info: %v\n", err)
+		p.logger.Warn("failed to parse user info", "error", err)
 	} else {
-		fmt.Printf("Processing ChatGPT export for user: %s\n", user.Name)
+		p.logger.Info("Processing ChatGPT export", "user", user.Name)
 	}
 
 	// Process media files
 	mediaInfo, err := p.chatgptParser.GetMediaFiles()
+	if err == nil {
+		// With a filter, keep only the media of the selected conversations
+		err = p.selectChatGPTMedia(ctx, mediaInfo)
+		if ctx.Err() != nil {
+			return stats, ctx.Err()
+		}
+	}
 	if err != nil {
-		fmt.Printf("Warning: failed to scan media files: %v\n", err)
+		mediaInfo = nil
+		p.logger.Warn("failed to scan media files", "error", err)
 	} else {
-		fmt.Printf("Found %d images, %d DALL-E generations, %d user uploads, %d audio conversations\n",
-			len(mediaInfo.Images), len(mediaInfo.DalleGenerations), 
-			len(mediaInfo.UserUploads), len(mediaInfo.AudioConversations))
-		stats.MediaCount = len(mediaInfo.Images) + len(mediaInfo.DalleGenerations) + len(mediaInfo.UserUploads)
+		p.logger.Info("Found ChatGPT media", "images", len(mediaInfo.Images), "dalle_generations", len(mediaInfo.DalleGenerations),
+			"user_uploads", len(mediaInfo.UserUploads), "files", len(mediaInfo.Files), "audio_conversations", len(mediaInfo.AudioConversations))
+		stats.MediaCount = len(mediaInfo.Images) + len(mediaInfo.DalleGenerations) + len(mediaInfo.UserUploads) + len(mediaInfo.Files)
 	}
 
-	// Save media info and optionally copy files
+	// Optionally copy media files
 	if mediaInfo != nil {
-		// Convert absolute paths to relative paths from output directory
-		relativeMediaInfo := p.convertToRelativePaths(mediaInfo)
-		
-		// Save media info with relative paths
-		mediaPath := filepath.Join(p.outputPath, "chatgpt", "media", "media_info.json")
-		if err := p.saveMediaInfo(*relativeMediaInfo, mediaPath); err != nil {
-			fmt.Printf("Warning: failed to save media info: %v\n", err)
-		}
-		
-		// Optionally copy media files
 		if p.copyMedia {
-			fmt.Println("Copying ChatGPT media files...")
-			if err := p.copyChatGPTMediaFiles(mediaInfo); err != nil {
-				fmt.Printf("Warning: failed to copy some media files: %v\n", err)
+			p.logger.Info("Placing ChatGPT media files...", "mode", p.mediaMode)
+			if err := p.copyChatGPTMediaFiles(ctx, mediaInfo); err != nil {
+				if ctx.Err() != nil {
+					return stats, ctx.Err()
+				}
+				p.logger.Warn("failed to copy some media files", "error", err)
 			} else {
-				fmt.Println("✓ Copied media files")
+				p.logger.Info("Placed media files", p.mediaModeCountAttrs()...)
+			}
+		}
+
+		// Optionally create thumbnails for the gallery
+		if p.gallery {
+			p.logger.Info("Creating image thumbnails...")
+			if err := p.generateThumbnails(ctx, mediaInfo); err != nil {
+				if ctx.Err() != nil {
+					return stats, ctx.Err()
+				}
+				p.logger.Warn("failed to create thumbnails", "error", err)
 			}
 		}
 	}
 
 	// Process conversations using the new parser
-	err = p.chatgptParser.ParseConversations(func(chatgpt models.ChatGPTConversation) error {
-		conv := parser.ConvertChatGPTToStandard(chatgpt)
-		
-		// Determine output path
-		year := conv.Metadata.CreatedDate.Format("2006")
-		month := conv.Metadata.CreatedDate.Format("01")
-		outputDir := filepath.Join(p.outputPath, "chatgpt", "chats", year, month)
-		if err := os.MkdirAll(outputDir, 0755); err != nil {
-			return err
+	err = p.chatgptParser.ParseConversations(ctx, func(chatgpt models.ChatGPTConversation, conv models.Conversation) error {
+		if !p.filter.Matches(conv) {
+			stats.FilteredCount++
+			p.report.recordSkipped("conversation", conv.Metadata.ID, "did not match filters")
+			return nil
 		}
 
-		// Generate filename
-		filename := fmt.Sprintf("%s_%s.json",
-			conv.Metadata.CreatedDate.Format("2006-01-02"),
-			utils.SanitizeFilename(conv.Metadata.Title))
-		
-		outputPath := filepath.Join(outputDir, filename)
-		// Store relative path instead of full path
-		relPath, err := filepath.Rel(p.outputPath, outputPath)
-		if err != nil {
-			relPath = filepath.Join("chatgpt", "chats", year, month, filename) // fallback
+		// Redact before linking: the linked clips keep their transcripts for the media info
+		p.redactConversation(&conv)
+
+		// Link voice-mode audio clips to the exported audio files
+		if mediaInfo != nil {
+			p.linkAudioClips(&conv, mediaInfo)
 		}
+
+		// Determine output path
+		relPath := p.claimOutputPath(conv.Metadata.ID, p.conversationPath(conv.Metadata, ""))
 		conv.Metadata.FilePath = relPath
 
-		// Save conversation
-		if err := p.saveConversation(conv, outputPath); err != nil {
-			return err
+		// Save conversation unless the previous run already wrote it from the same
+		// source; linked audio clips depend on the media files, so they are hashed too
+		hash := sourceHash(chatgpt, audioClipsOf(conv))
+		if p.isUnchanged(conv.Metadata.ID, hash, relPath) {
+			stats.UnchangedCount++
+		} else {
+			if err := p.saveConversation(conv, relPath); err != nil {
+				stats.FailedCount++
+				p.report.recordFailure("conversation", conv.Metadata.ID, err)
+				return nil
+			}
+			p.recordConversation(conv.Metadata.ID, hash, relPath)
 		}
 
 		// Add to indexer
 		p.indexer.AddConversation(conv.Metadata)
 
+		// Remember DALL-E generations for the prompt catalog
+		p.recordDalleGenerations(chatgpt, conv.Metadata)
+		if p.gallery {
+			p.recordImageReferences(chatgpt, conv.Metadata)
+		}
+
+		p.report.recordProject(conv.Metadata)
 		stats.ConversationCount++
 		stats.MessageCount += len(conv.Messages)
 
 		return nil
 	})
+	if ctx.Err() != nil {
+		return stats, ctx.Err()
+	}
+
+	if mediaInfo != nil {
+		// Convert absolute paths to relative paths from output directory
+		relativeMediaInfo := p.convertToRelativePaths(mediaInfo)
+		p.attachAudioClips(relativeMediaInfo)
+
+		// Save media info with relative paths and the audio clips linked to messages
+		mediaPath := filepath.Join("chatgpt", "media", "media_info.json")
+		if err := p.saveMediaInfo(*relativeMediaInfo, mediaPath); err != nil {
+			p.logger.Warn("failed to save media info", "path", mediaPath, "error", err)
+		}
+
+		// Build the DALL-E prompt catalog now that all conversations are known
+		if err := p.generateDalleCatalog(mediaInfo); err != nil {
+			p.logger.Warn("failed to generate DALL-E catalog", "error", err)
+		}
+
+		// Write the HTML gallery now that images can be linked to conversations
+		if p.gallery {
+			if err := p.generateGallery(mediaInfo); err != nil {
+				p.logger.Warn("failed to generate media gallery", "error", err)
+			}
+		}
+	}
 
 	return stats, err
 }
 
-// saveConversation saves a conversation to disk
-func (p *Processor) saveConversation(conv models.Conversation, outputPath string) error {
-	file, err := os.Create(outputPath)
+// saveConversation saves a conversation to the output
+func (p *Processor) saveConversation(conv models.Conversation, relPath string) error {
+	file, err := p.createOutput(relPath)
 	if err != nil {
 		return err
 	}
@@ -405,12 +634,15 @@ func (p *Processor) saveConversation(conv models.Conversation, outputPath string
 
 	encoder := json.NewEncoder(file)
 	encoder.SetIndent("", "  ")
-	return encoder.Encode(conv)
+	if err := encoder.Encode(conv); err != nil {
+		return err
+	}
+	return file.Commit()
 }
 
-// saveProject saves a project to disk
-func (p *Processor) saveProject(project models.ClaudeProject, outputPath string) error {
-	file, err := os.Create(outputPath)
+// saveProject saves a project to the output
+func (p *Processor) saveProject(project models.ClaudeProject, relPath string) error {
+	file, err := p.createOutput(relPath)
 	if err != nil {
 		return err
 	}
@@ -418,32 +650,31 @@ func (p *Processor) saveProject(project models.ClaudeProject, outputPath string)
 
 	encoder := json.NewEncoder(file)
 	encoder.SetIndent("", "  ")
-	return encoder.Encode(project)
-}
-
-// saveDocument saves a project document to disk as markdown
-func (p *Processor) saveDocument(doc models.ClaudeDocument, outputPath string) error {
-	file, err := os.Create(outputPath)
-	if err != nil {
+	if err := encoder.Encode(project); err != nil {
 		return err
 	}
-	defer file.Close()
+	return file.Commit()
+}
+
+// saveDocument saves a project document to the output as markdown
+func (p *Processor) saveDocument(doc models.ClaudeDocument, relPath string) error {
+	return p.writeOutput(relPath, []byte(documentContent(doc)))
+}
 
-	// Write document with metadata header
+// documentContent returns a project document with its metadata header
+func documentContent(doc models.ClaudeDocument) string {
 	content := fmt.Sprintf("# %s\n\n", doc.Filename)
 	if doc.CreatedAt != "" {
 		content += fmt.Sprintf("**Created:** %s\n\n", doc.CreatedAt)
 	}
 	content += "---\n\n"
 	content += doc.Content
-
-	_, err = file.WriteString(content)
-	return err
+	return content
 }
 
-// saveMediaInfo saves media information to disk
-func (p *Processor) saveMediaInfo(mediaInfo models.ChatGPTMediaInfo, outputPath string) error {
-	file, err := os.Create(outputPath)
+// saveMediaInfo saves media information to the output
+func (p *Processor) saveMediaInfo(mediaInfo models.ChatGPTMediaInfo, relPath string) error {
+	file, err := p.createOutput(relPath)
 	if err != nil {
 		return err
 	}
@@ -451,38 +682,27 @@ func (p *Processor) saveMediaInfo(mediaInfo models.ChatGPTMediaInfo, outputPath
 
 	encoder := json.NewEncoder(file)
 	encoder.SetIndent("", "  ")
-	return encoder.Encode(mediaInfo)
-}
-
-// generateReport generates a transformation report
-func (p *Processor) generateReport(stats ProcessingStats) error {
-	report := map[string]interface{}{
-		"transformation_completed": time.Now(),
-		"statistics": map[string]interface{}{
-			"conversations_processed": stats.ConversationCount,
-			"messages_processed":      stats.MessageCount,
-			"media_files_processed":   stats.MediaCount,
-			"projects_processed":      stats.ProjectCount,
-			"processing_duration":     stats.EndTime.Sub(stats.StartTime).String(),
-		},
-		"output_structure": "see README.md for details",
-	}
-
-	reportPath := filepath.Join(p.outputPath, "transformation_report.json")
-	file, err := os.Create(reportPath)
-	if err != nil {
+	if err := encoder.Encode(mediaInfo); err != nil {
 		return err
 	}
-	defer file.Close()
-
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	return encoder.Encode(report)
+	return file.Commit()
 }
 
 // createREADMEFiles creates README.md files for each container directory
 func (p *Processor) createREADMEFiles() error {
-	readmeContents := map[string]string{
+	for path, content := range readmeFiles() {
+		if err := p.writeOutput(path, []byte(content)); err != nil {
+			return fmt.Errorf("failed to create %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// readmeFiles returns the README.md files of the container directories, by path
+// relative to the output directory
+func readmeFiles() map[string]string {
+	return map[string]string{
 		"claude/README.md": `# Claude Export Data
 
 This directory contains processed Claude conversation exports.
@@ -571,7 +791,28 @@ This directory contains media file references and metadata for ChatGPT conversat
   - Images uploaded to conversations
   - DALL-E generated images
   - User uploads
+  - Other files (PDFs, spreadsheets, videos, ...)
   - Audio conversation files
+- **dalle_catalog.json** - DALL-E images with the prompt and conversation that produced them
+- **dalle_catalog.md** - Browsable version of the DALL-E prompt catalog
+
+File types are detected from content (magic bytes): every entry records its
+MIME type and kind, and images also record their format, width and height.
+
+Voice conversation audio is linked to its messages: each entry in
+audio_conversations lists its clips with message ID, transcript and timing.
+
+With --media-mode=copy|hardlink|symlink the files are placed in the folders
+below; each entry in media_info.json records the mode actually used
+(link_mode), since links fall back to copying across filesystems.
+
+With --gallery, **thumbnails/** holds downscaled PNG/JPEG/GIF images and
+**gallery.html** shows them grouped by month and conversation, each thumbnail
+linking to its conversation.
+
+With --content-addressed, copied files are stored once per content
+hash under **objects/** and **media_store.json** maps each media name to its
+SHA-256. Files already present in the store are not copied again.
 
 Media files are referenced by their original filenames and paths from the export.
 `,
@@ -593,85 +834,52 @@ Future additions may include:
 - Topic clustering across platforms
 `,
 	}
-
-	for path, content := range readmeContents {
-		fullPath := filepath.Join(p.outputPath, path)
-		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
-			// Don't fail if README already exists
-			if !os.IsExist(err) {
-				return fmt.Errorf("failed to create %s: %w", path, err)
-			}
-		}
-	}
-
-	return nil
 }
 
 // convertToRelativePaths converts absolute media file paths to relative paths from output directory
 func (p *Processor) convertToRelativePaths(mediaInfo *models.ChatGPTMediaInfo) *models.ChatGPTMediaInfo {
 	result := &models.ChatGPTMediaInfo{
-		Images:             make([]models.MediaFile, len(mediaInfo.Images)),
-		DalleGenerations:   make([]models.MediaFile, len(mediaInfo.DalleGenerations)),
-		UserUploads:        make([]models.MediaFile, len(mediaInfo.UserUploads)),
+		Images:             p.relativeMediaFiles(mediaInfo.Images),
+		DalleGenerations:   p.relativeMediaFiles(mediaInfo.DalleGenerations),
+		UserUploads:        p.relativeMediaFiles(mediaInfo.UserUploads),
+		Files:              p.relativeMediaFiles(mediaInfo.Files),
 		AudioConversations: make([]models.AudioConversation, len(mediaInfo.AudioConversations)),
 	}
 
-	// Convert images
-	for i, file := range mediaInfo.Images {
-		result.Images[i] = models.MediaFile{
-			Name:     file.Name,
-			Path:     p.getRelativeMediaPath(file.Path),
-			Size:     file.Size,
-			Modified: file.Modified,
-		}
-	}
-
-	// Convert DALL-E generations
-	for i, file := range mediaInfo.DalleGenerations {
-		result.DalleGenerations[i] = models.MediaFile{
-			Name:     file.Name,
-			Path:     p.getRelativeMediaPath(file.Path),
-			Size:     file.Size,
-			Modified: file.Modified,
-		}
-	}
-
-	// Convert user uploads
-	for i, file := range mediaInfo.UserUploads {
-		result.UserUploads[i] = models.MediaFile{
-			Name:     file.Name,
-			Path:     p.getRelativeMediaPath(file.Path),
-			Size:     file.Size,
-			Modified: file.Modified,
-		}
-	}
-
 	// Convert audio conversations
 	for i, audioConv := range mediaInfo.AudioConversations {
 		result.AudioConversations[i] = models.AudioConversation{
 			ConversationID: audioConv.ConversationID,
-			AudioFiles:     make([]models.MediaFile, len(audioConv.AudioFiles)),
-		}
-		for j, file := range audioConv.AudioFiles {
-			result.AudioConversations[i].AudioFiles[j] = models.MediaFile{
-				Name:     file.Name,
-				Path:     p.getRelativeMediaPath(file.Path),
-				Size:     file.Size,
-				Modified: file.Modified,
-			}
+			AudioFiles:     p.relativeMediaFiles(audioConv.AudioFiles),
 		}
 	}
 
 	return result
 }
 
+// relativeMediaFiles copies media files with their paths made relative to the output directory
+func (p *Processor) relativeMediaFiles(files []models.MediaFile) []models.MediaFile {
+	result := make([]models.MediaFile, len(files))
+	for i, file := range files {
+		result[i] = file
+		result[i].Path = p.getRelativeMediaPath(file.Path)
+	}
+	return result
+}
+
 // getRelativeMediaPath converts an absolute media path to a relative path from output directory
 func (p *Processor) getRelativeMediaPath(absolutePath string) string {
-	// Try to create a relative path from output directory to the media file
+	// Files of an input that is not on disk are identified by their path inside it
+	if !p.input.OnDisk() {
+		return absolutePath
+	}
+
+	// Try to create a relative path from output directory to the media file. An
+	// output built in memory says nothing about where it will be extracted.
 	relPath, err := filepath.Rel(p.outputPath, absolutePath)
-	if err != nil {
+	if err != nil || p.outputPath == "" {
 		// If that fails, create a relative path to the raw directory
-		inputBase := filepath.Dir(p.inputPath)
+		inputBase := filepath.Dir(p.input.Dir)
 		relToInput, err2 := filepath.Rel(inputBase, absolutePath)
 		if err2 != nil {
 			// Last resort: return the filename only
@@ -681,4 +889,4 @@ func (p *Processor) getRelativeMediaPath(absolutePath string) string {
 		return filepath.Join("..", relToInput)
 	}
 	return relPath
-}
\ No newline at end of file
+}
@@ -0,0 +1,191 @@
+package processor
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/oisee/chat-transformer/internal/sink"
+)
+
+func TestSinkOnlyRunStaysInMemory(t *testing.T) {
+	// Load the exports into memory, so the run has no files on disk to start from
+	input := loadTestdata(t, "redaction")
+
+	// Creating a temporary directory fails, and anything else the run writes on
+	// disk would end up in the working directory
+	t.Setenv("TMPDIR", filepath.Join(t.TempDir(), "missing"))
+	workDir := t.TempDir()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(workDir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+
+	var archive bytes.Buffer
+	p, err := New(Options{
+		InputFS:        input,
+		Sink:           sink.NewZip(&archive),
+		MediaMode:      MediaModeCopy,
+		Gallery:        true,
+		RenderMarkdown: true,
+		Logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(workDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Errorf("run wrote %s", entry.Name())
+	}
+
+	names := zipNames(t, archive.Bytes())
+	markdown := 0
+	for name := range names {
+		if strings.HasSuffix(name, ".md") {
+			markdown++
+		}
+	}
+	for _, name := range []string{
+		"unified/conversations_index.json",
+		"chatgpt/media/media_info.json",
+		"chatgpt/media/gallery.html",
+		"processing_manifest.json",
+	} {
+		if !names[name] {
+			t.Errorf("archive is missing %s", name)
+		}
+	}
+	if markdown == 0 {
+		t.Error("archive has no rendered markdown")
+	}
+}
+
+func TestFilterLimitsProjectsAndMedia(t *testing.T) {
+	tests := []struct {
+		name      string
+		ids       []string
+		projects  []string
+		wantFiles []string
+		skipFiles []string
+	}{
+		{
+			name:      "selected conversations outside projects",
+			ids:       []string{"c-0001"},
+			skipFiles: []string{"claude/projects/Tooling/project.json", "chatgpt/media/audio-conversations/g-0001-aaaa-bbbb-voice/"},
+		},
+		{
+			name:      "selected conversations in projects and with audio",
+			ids:       []string{"c-0002", "g-0001-aaaa-bbbb-voice"},
+			wantFiles: []string{"claude/projects/Tooling/project.json", "chatgpt/media/audio-conversations/g-0001-aaaa-bbbb-voice/"},
+		},
+		{
+			name:      "project named without selected conversations",
+			ids:       []string{"c-0001"},
+			projects:  []string{"Tooling"},
+			wantFiles: []string{"claude/projects/Tooling/project.json"},
+		},
+	}
+
+	input := loadTestdata(t, "redaction")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := make(map[string]bool)
+			for _, id := range tt.ids {
+				ids[id] = true
+			}
+
+			var archive bytes.Buffer
+			p, err := New(Options{
+				InputFS:   input,
+				Sink:      sink.NewZip(&archive),
+				MediaMode: MediaModeCopy,
+				Gallery:   true,
+				Filter:    Filter{IDs: ids, Projects: tt.projects},
+				Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := p.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			names := zipNames(t, archive.Bytes())
+			for _, want := range tt.wantFiles {
+				if !hasPrefix(names, want) {
+					t.Errorf("output is missing %s", want)
+				}
+			}
+			for _, skip := range tt.skipFiles {
+				if hasPrefix(names, skip) {
+					t.Errorf("output has %s", skip)
+				}
+			}
+		})
+	}
+}
+
+// loadTestdata loads the exports in a folder of testdata into memory
+func loadTestdata(t *testing.T, name string) fstest.MapFS {
+	t.Helper()
+	root := filepath.Join("testdata", name)
+	input := make(fstest.MapFS)
+	err := fs.WalkDir(os.DirFS(root), ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(filepath.Join(root, path))
+		if err != nil {
+			return err
+		}
+		input[path] = &fstest.MapFile{Data: data}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input
+}
+
+// zipNames returns the names of the files in a zip archive
+func zipNames(t *testing.T, data []byte) map[string]bool {
+	t.Helper()
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	for _, file := range reader.File {
+		names[file.Name] = true
+	}
+	return names
+}
+
+// hasPrefix reports whether any of names starts with prefix
+func hasPrefix(names map[string]bool, prefix string) bool {
+	for name := range names {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package processor
+
+import (
+	"encoding/json"
+
+	"github.com/oisee/chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/redact"
+)
+
+// File (inside the output directory) counting the values a run redacted
+const redactionReportFile = "redaction_report.json"
+
+// redactConversation replaces personal data and secrets in a conversation with
+// placeholders and records how many values were replaced
+func (p *Processor) redactConversation(conv *models.Conversation) {
+	if p.redactor == nil {
+		return
+	}
+	counts := p.redactor.Redact(conv)
+	if len(counts) == 0 {
+		return
+	}
+
+	p.redactionMutex.Lock()
+	defer p.redactionMutex.Unlock()
+	p.redactions = append(p.redactions, models.RedactedConversation{
+		ID:       conv.Metadata.ID,
+		Platform: conv.Metadata.Platform,
+		Counts:   counts,
+	})
+}
+
+// redactProject replaces personal data and secrets in the description and
+// documents of a Claude project and records how many values were replaced
+func (p *Processor) redactProject(project *models.ClaudeProject) {
+	if p.redactor == nil {
+		return
+	}
+	counts := p.redactor.RedactProject(project)
+	if len(counts) == 0 {
+		return
+	}
+
+	p.redactionMutex.Lock()
+	defer p.redactionMutex.Unlock()
+	p.projectRedactions = append(p.projectRedactions, models.RedactedConversation{
+		ID:       project.UUID,
+		Platform: "claude",
+		Counts:   counts,
+	})
+}
+
+// redactionReport summarizes the redactions of the run
+func (p *Processor) redactionReport() models.RedactionReport {
+	p.redactionMutex.Lock()
+	defer p.redactionMutex.Unlock()
+
+	totals := make(redact.Counts)
+	for _, conv := range p.redactions {
+		totals.Add(conv.Counts)
+	}
+	for _, project := range p.projectRedactions {
+		totals.Add(project.Counts)
+	}
+	return models.RedactionReport{
+		GeneratedAt:   p.now(),
+		Rules:         p.redactor.RuleNames(),
+		Totals:        totals,
+		Conversations: append([]models.RedactedConversation{}, p.redactions...),
+		Projects:      append([]models.RedactedConversation(nil), p.projectRedactions...),
+	}
+}
+
+// logRedactions logs how many values the run redacted
+func (p *Processor) logRedactions() {
+	report := p.redactionReport()
+	total := 0
+	for _, n := range report.Totals {
+		total += n
+	}
+	p.logger.Info("Redacted conversations", "values", total, "conversations", len(report.Conversations), "projects", len(report.Projects))
+}
+
+// saveRedactionReport writes the redaction report to the output directory
+func (p *Processor) saveRedactionReport() error {
+	report := p.redactionReport()
+
+	file, err := p.createOutput(redactionReportFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	return file.Commit()
+}
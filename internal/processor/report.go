@@ -0,0 +1,235 @@
+package processor
+
+import (
+	"encoding/json"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/oisee/chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/utils"
+)
+
+// File (inside the output directory) holding the transformation report
+const reportFile = "transformation_report.json"
+
+// runReport collects what happens during a run for the transformation report
+type runReport struct {
+	mutex     sync.Mutex // protects all fields
+	startTime time.Time
+	phases    []models.PhaseTiming
+	platforms map[string]models.ReportStatistics
+	projects  map[string]int // platform/project -> conversations
+	skipped   []models.ReportItem
+	failed    []models.ReportItem
+	warnings  []string
+	logger    *slog.Logger // writes to the run's logger, collecting warnings
+}
+
+// newRunReport starts collecting a report, including every warning logged through
+// its logger, which passes all messages on to base
+func newRunReport(base *slog.Logger) *runReport {
+	report := &runReport{
+		startTime: time.Now(),
+		platforms: make(map[string]models.ReportStatistics),
+		projects:  make(map[string]int),
+	}
+	report.logger = slog.New(utils.NewWarningCollector(base.Handler(), func(message string) {
+		report.mutex.Lock()
+		defer report.mutex.Unlock()
+		report.warnings = append(report.warnings, message)
+	}))
+	return report
+}
+
+// recordPhase records the duration of a phase that started at start
+func (r *runReport) recordPhase(name string, start time.Time) {
+	duration := time.Since(start)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.phases = append(r.phases, models.PhaseTiming{
+		Name:     name,
+		Duration: duration.Round(time.Millisecond).String(),
+		Seconds:  duration.Seconds(),
+	})
+}
+
+// recordStats adds the statistics of a processing step to a platform
+func (r *runReport) recordStats(platform string, stats ProcessingStats) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	total := r.platforms[platform]
+	total.Conversations += stats.ConversationCount
+	total.Messages += stats.MessageCount
+	total.MediaFiles += stats.MediaCount
+	total.Projects += stats.ProjectCount
+	total.Unchanged += stats.UnchangedCount
+	total.Filtered += stats.FilteredCount
+	total.Failed += stats.FailedCount
+	r.platforms[platform] = total
+}
+
+// recordProject counts a processed conversation of a project
+func (r *runReport) recordProject(metadata models.ConversationMetadata) {
+	if metadata.Project == "" {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.projects[metadata.Platform+"/"+metadata.Project]++
+}
+
+// recordSkipped records an item that was deliberately not processed
+func (r *runReport) recordSkipped(kind, id, reason string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.skipped = append(r.skipped, models.ReportItem{Kind: kind, ID: id, Reason: reason})
+}
+
+// recordFailure records and reports an item that could not be written
+func (r *runReport) recordFailure(kind, id string, err error) {
+	field := "id"
+	if kind == "conversation" {
+		field = "conversation_id"
+	}
+	r.logger.Warn("failed to save item", "kind", kind, field, id, "error", err)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.failed = append(r.failed, models.ReportItem{Kind: kind, ID: id, Reason: err.Error()})
+}
+
+// generateReport writes the transformation report
+func (p *Processor) generateReport() error {
+	r := p.report
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	completed := time.Now()
+	report := models.TransformationReport{
+		Tool:            p.buildInfo,
+		StartedAt:       r.startTime,
+		CompletedAt:     completed,
+		Duration:        completed.Sub(r.startTime).Round(time.Millisecond).String(),
+		Phases:          r.phases,
+		Platforms:       r.platforms,
+		Projects:        r.projects,
+		Inputs:          p.fingerprintInputs(),
+		Skipped:         sortedItems(r.skipped),
+		Failed:          sortedItems(r.failed),
+		Warnings:        r.warnings,
+		OutputStructure: "see README.md for details",
+	}
+
+	for _, stats := range r.platforms {
+		report.Statistics.Conversations += stats.Conversations
+		report.Statistics.Messages += stats.Messages
+		report.Statistics.MediaFiles += stats.MediaFiles
+		report.Statistics.Projects += stats.Projects
+		report.Statistics.Unchanged += stats.Unchanged
+		report.Statistics.Filtered += stats.Filtered
+		report.Statistics.Failed += stats.Failed
+	}
+	report.Statistics.Collisions = p.collisions
+
+	// Timings differ between runs, so reproducible reports only name the phases
+	if p.reproducible {
+		report.StartedAt = p.sourceDate
+		report.CompletedAt = p.sourceDate
+		report.Duration = "0s"
+		phases := make([]models.PhaseTiming, len(r.phases))
+		for i, phase := range r.phases {
+			phases[i] = models.PhaseTiming{Name: phase.Name, Duration: "0s"}
+		}
+		report.Phases = phases
+	}
+
+	// Empty lists are written as [] rather than null
+	if report.Phases == nil {
+		report.Phases = []models.PhaseTiming{}
+	}
+	if report.Warnings == nil {
+		report.Warnings = []string{}
+	}
+
+	file, err := p.createOutput(reportFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	if err := file.Commit(); err != nil {
+		return err
+	}
+
+	p.written = &report
+	return nil
+}
+
+// Report returns the transformation report written by the last completed run, or
+// nil before a run has completed
+func (p *Processor) Report() *models.TransformationReport {
+	return p.written
+}
+
+// fingerprintInputs identifies the export files in the input directory by size,
+// modification time and SHA-256
+func (p *Processor) fingerprintInputs() []models.InputFingerprint {
+	fingerprints := []models.InputFingerprint{}
+
+	paths, err := fs.Glob(p.input.FS, "*/*.json")
+	if err != nil {
+		return fingerprints
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		info, err := fs.Stat(p.input.FS, path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		hash, _, err := hashFile(p.input, p.input.Path(path))
+		if err != nil {
+			p.logger.Warn("failed to fingerprint input", "path", path, "error", err)
+			continue
+		}
+		fingerprints = append(fingerprints, models.InputFingerprint{
+			Path:     path,
+			Size:     info.Size(),
+			Modified: info.ModTime().UTC(),
+			SHA256:   hash,
+		})
+	}
+	return fingerprints
+}
+
+// sortedItems sorts report items by kind and ID, returning an empty list for nil
+func sortedItems(items []models.ReportItem) []models.ReportItem {
+	if items == nil {
+		return []models.ReportItem{}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Kind != items[j].Kind {
+			return items[i].Kind < items[j].Kind
+		}
+		return items[i].ID < items[j].ID
+	})
+	return items
+}
+
+// counts returns the report totals as log fields
+func (r *runReport) counts() []interface{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return []interface{}{"skipped", len(r.skipped), "failed", len(r.failed), "warnings", len(r.warnings)}
+}
@@ -0,0 +1,144 @@
+package processor
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/oisee/chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/parser"
+)
+
+// selectClaudeProjects returns the names of the Claude projects holding a
+// conversation the filter selects. It returns nil, selecting every project, when
+// no filter is set or the filter names its projects.
+func (p *Processor) selectClaudeProjects(ctx context.Context, projects []models.ClaudeProject) (map[string]bool, error) {
+	if p.filter.IsEmpty() || len(p.filter.Projects) > 0 {
+		return nil, nil
+	}
+
+	projectMap := make(map[string]models.ClaudeProject)
+	for _, project := range projects {
+		projectMap[project.UUID] = project
+	}
+
+	// The conversations are parsed again when they are processed; warn only then
+	p.claudeParser.SetLogger(discardLogger())
+	defer p.claudeParser.SetLogger(p.logger)
+
+	selected := make(map[string]bool)
+	err := p.claudeParser.ParseConversations(ctx, projectMap, func(_ models.ClaudeConversation, conv models.Conversation) error {
+		if conv.Metadata.Project != "" && p.filter.Matches(conv) {
+			selected[conv.Metadata.Project] = true
+		}
+		return nil
+	})
+	return selected, err
+}
+
+// projectSelected reports whether a Claude project is written, given the
+// projects returned by selectClaudeProjects
+func (p *Processor) projectSelected(project models.ClaudeProject, selected map[string]bool) bool {
+	return p.filter.MatchesProject(project.Name) && (selected == nil || selected[project.Name])
+}
+
+// selectChatGPTMedia limits the media info to the files referenced by the
+// conversations the filter selects, and the audio of those conversations. It
+// leaves the media info untouched when no filter is set.
+func (p *Processor) selectChatGPTMedia(ctx context.Context, mediaInfo *models.ChatGPTMediaInfo) error {
+	if p.filter.IsEmpty() {
+		return nil
+	}
+
+	// The conversations are parsed again when they are processed; warn only then
+	p.chatgptParser.SetLogger(discardLogger())
+	defer p.chatgptParser.SetLogger(p.logger)
+
+	conversations := make(map[string]bool)
+	files := make(map[string]bool)
+	err := p.chatgptParser.ParseConversations(ctx, func(chatgpt models.ChatGPTConversation, conv models.Conversation) error {
+		if !p.filter.Matches(conv) {
+			return nil
+		}
+		conversations[conv.Metadata.ID] = true
+		for id := range referencedFiles(chatgpt) {
+			files[id] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	kept, skipped := 0, 0
+	selectFiles := func(all []models.MediaFile) []models.MediaFile {
+		selected := []models.MediaFile{}
+		for _, file := range all {
+			if fileReferenced(file, files) {
+				selected = append(selected, file)
+				kept++
+			} else {
+				skipped++
+			}
+		}
+		return selected
+	}
+	mediaInfo.Images = selectFiles(mediaInfo.Images)
+	mediaInfo.DalleGenerations = selectFiles(mediaInfo.DalleGenerations)
+	mediaInfo.UserUploads = selectFiles(mediaInfo.UserUploads)
+	mediaInfo.Files = selectFiles(mediaInfo.Files)
+
+	audioConversations := []models.AudioConversation{}
+	for _, audioConv := range mediaInfo.AudioConversations {
+		if conversations[audioConv.ConversationID] {
+			audioConversations = append(audioConversations, audioConv)
+			kept += len(audioConv.AudioFiles)
+		} else {
+			skipped += len(audioConv.AudioFiles)
+		}
+	}
+	mediaInfo.AudioConversations = audioConversations
+
+	p.logger.Info("Selected media of the filtered conversations", "kept", kept, "skipped", skipped)
+	return nil
+}
+
+// referencedFiles returns the file IDs of the assets in a conversation and the
+// IDs and names of the files attached to its messages
+func referencedFiles(chatgpt models.ChatGPTConversation) map[string]bool {
+	files := make(map[string]bool)
+	for _, node := range chatgpt.Mapping {
+		if node.Message == nil {
+			continue
+		}
+		for _, asset := range node.Message.Content.Assets {
+			files[parser.AssetFileID(asset.AssetPointer)] = true
+		}
+
+		attachments, _ := node.Message.Metadata["attachments"].([]interface{})
+		for _, attachment := range attachments {
+			fields, _ := attachment.(map[string]interface{})
+			for _, key := range []string{"id", "name"} {
+				if value, ok := fields[key].(string); ok && value != "" {
+					files[value] = true
+				}
+			}
+		}
+	}
+	return files
+}
+
+// fileReferenced reports whether an exported media file is one of the referenced files
+func fileReferenced(file models.MediaFile, files map[string]bool) bool {
+	for _, id := range parser.AssetFileIDs(file.Name) {
+		if files[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// discardLogger returns a logger that drops every message
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
@@ -0,0 +1,121 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/oisee/chat-transformer/internal/indexer"
+	"github.com/oisee/chat-transformer/internal/renderer"
+	"github.com/oisee/chat-transformer/internal/sink"
+)
+
+// Suffixes of the directories used next to the output directory by staged runs
+const (
+	stagingSuffix  = ".staging"
+	previousSuffix = ".previous"
+)
+
+// runStaged runs the transformation in a staging directory and replaces the output
+// directory with it on success. A failed run leaves the output directory untouched;
+// a cancelled run keeps the staging directory so it can be resumed.
+func (p *Processor) runStaged(ctx context.Context) error {
+	finalPath := p.outputPath
+	stagingPath := finalPath + stagingSuffix
+	previousPath := finalPath + previousSuffix
+
+	if p.resume && fileExists(filepath.Join(stagingPath, checkpointFile)) {
+		p.logger.Info("Resuming staged run", "path", stagingPath)
+	} else {
+		// Discard whatever an interrupted staged run left behind
+		if err := os.RemoveAll(stagingPath); err != nil {
+			return fmt.Errorf("failed to remove old staging directory: %w", err)
+		}
+
+		// Start from the current output so unchanged conversations and stored media are reused
+		p.logger.Info("Staging run", "path", stagingPath)
+		if err := p.cloneTree(finalPath, stagingPath); err != nil {
+			os.RemoveAll(stagingPath)
+			return fmt.Errorf("failed to prepare staging directory: %w", err)
+		}
+	}
+
+	p.setOutputPath(stagingPath)
+	err := p.run(ctx)
+	p.setOutputPath(finalPath)
+	if err != nil {
+		if ctx.Err() == nil {
+			os.RemoveAll(stagingPath)
+		}
+		return err
+	}
+
+	// Swap the staged output into place, restoring the old one if that fails
+	if err := os.RemoveAll(previousPath); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", previousPath, err)
+	}
+	if err := os.Rename(finalPath, previousPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to move old output aside: %w", err)
+	}
+	if err := os.Rename(stagingPath, finalPath); err != nil {
+		os.Rename(previousPath, finalPath)
+		return fmt.Errorf("failed to move staged output into place: %w", err)
+	}
+	if err := os.RemoveAll(previousPath); err != nil {
+		p.logger.Warn("failed to remove previous output", "path", previousPath, "error", err)
+	}
+
+	p.logger.Info("Moved staged output into place", "path", finalPath)
+	return nil
+}
+
+// setOutputPath points the processor, indexer and renderer at another output directory
+func (p *Processor) setOutputPath(outputPath string) {
+	p.outputPath = outputPath
+	p.output = sink.NewDirTree(outputPath)
+	p.indexer = indexer.New(p.output)
+	if p.reproducible {
+		p.indexer.SetTimestamp(p.sourceDate)
+	}
+	p.renderer = renderer.New(p.output)
+	p.renderer.SetWorkers(p.renderWorkers)
+}
+
+// cloneTree recreates the directory tree at src under dst, hard linking files where
+// possible. Every output file is replaced through a rename, so the links never let
+// the staged run modify the original files.
+func (p *Processor) cloneTree(src, dst string) error {
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return os.MkdirAll(dst, 0755)
+	}
+
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, relPath)
+
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(target, 0755)
+		case entry.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			if err := os.Link(path, target); err == nil {
+				return nil
+			}
+			return p.copyFile(path, target)
+		}
+	})
+}
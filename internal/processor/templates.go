@@ -0,0 +1,182 @@
+package processor
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/oisee/chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/utils"
+)
+
+// PathTemplates control where conversations, projects and media are written,
+// relative to the output directory. Placeholders are written as {name}, or as
+// {name|"fallback"} to use fallback when the value is empty.
+//
+// Conversations: {platform} {project} {yyyy} {mm} {dd} {date} {slug} {id} {id8}
+// Projects:      {platform} {project} {id} {id8}
+// Media:         {platform} {folder} {name}
+type PathTemplates struct {
+	Conversation        string // conversations outside a project
+	ProjectConversation string // conversations that belong to a project
+	Project             string // project directory holding project.json and documents/
+	Media               string // copied media files
+}
+
+// DefaultPathTemplates returns the standard output layout
+func DefaultPathTemplates() PathTemplates {
+	return PathTemplates{
+		Conversation:        "{platform}/chats/{yyyy}/{mm}/{date}_{slug}_{id8}.json",
+		ProjectConversation: "{platform}/projects/{project}/{date}_{slug}_{id8}.json",
+		Project:             "{platform}/projects/{project}",
+		Media:               "{platform}/media/{folder}/{name}",
+	}
+}
+
+// placeholderPattern matches {name} and {name|"fallback"}
+var placeholderPattern = regexp.MustCompile(`\{(\w+)(?:\|"([^"]*)")?\}`)
+
+var (
+	conversationPlaceholders = []string{"platform", "project", "yyyy", "mm", "dd", "date", "slug", "id", "id8"}
+	projectPlaceholders      = []string{"platform", "project", "id", "id8"}
+	mediaPlaceholders        = []string{"platform", "folder", "name"}
+)
+
+// Validate checks that every template only uses known placeholders, stays inside
+// the output directory and includes the placeholders that keep paths unique
+func (t PathTemplates) Validate() error {
+	checks := []struct {
+		flag     string
+		template string
+		known    []string
+		unique   []string // at least one of these is required
+		suffix   string
+	}{
+		{"conversation", t.Conversation, conversationPlaceholders, []string{"id", "id8"}, ".json"},
+		{"project conversation", t.ProjectConversation, conversationPlaceholders, []string{"id", "id8"}, ".json"},
+		{"project", t.Project, projectPlaceholders, []string{"project", "id", "id8"}, ""},
+		{"media", t.Media, mediaPlaceholders, []string{"name"}, ""},
+	}
+
+	for _, check := range checks {
+		if err := validateTemplate(check.template, check.known, check.unique, check.suffix); err != nil {
+			return fmt.Errorf("invalid %s template %q: %w", check.flag, check.template, err)
+		}
+	}
+
+	// Media folders are only unique when the folder is part of the path
+	if !strings.Contains(t.Media, "{folder") {
+		return fmt.Errorf("invalid media template %q: must contain {folder} so files from different folders cannot collide", t.Media)
+	}
+	return nil
+}
+
+// validateTemplate checks a single template
+func validateTemplate(template string, known, unique []string, suffix string) error {
+	if template == "" {
+		return fmt.Errorf("template is empty")
+	}
+	if filepath.IsAbs(template) || strings.HasPrefix(template, "/") {
+		return fmt.Errorf("template must be relative to the output directory")
+	}
+	for _, part := range strings.Split(filepath.ToSlash(template), "/") {
+		if part == ".." {
+			return fmt.Errorf("template must not leave the output directory")
+		}
+	}
+	if suffix != "" && !strings.HasSuffix(template, suffix) {
+		return fmt.Errorf("template must end in %s", suffix)
+	}
+
+	used := make(map[string]bool)
+	for _, match := range placeholderPattern.FindAllStringSubmatch(template, -1) {
+		if !utils.Contains(known, match[1]) {
+			return fmt.Errorf("unknown placeholder {%s} (expected one of %s)", match[1], strings.Join(known, ", "))
+		}
+		used[match[1]] = true
+	}
+	if stripped := placeholderPattern.ReplaceAllString(template, ""); strings.ContainsAny(stripped, "{}") {
+		return fmt.Errorf("malformed placeholder")
+	}
+
+	for _, name := range unique {
+		if used[name] {
+			return nil
+		}
+	}
+	return fmt.Errorf("must contain {%s} so that paths are unique", strings.Join(unique, "} or {"))
+}
+
+// expandTemplate replaces the placeholders of a template with values, using
+// the fallback of a placeholder when its value is empty
+func expandTemplate(template string, values map[string]string) string {
+	expanded := placeholderPattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+		match := placeholderPattern.FindStringSubmatch(placeholder)
+		if value := values[match[1]]; value != "" {
+			return value
+		}
+		return match[2]
+	})
+	return filepath.Clean(filepath.FromSlash(expanded))
+}
+
+// conversationPath returns the output path of a conversation relative to the
+// output directory. ProjectID identifies its Claude project, if any.
+func (p *Processor) conversationPath(metadata models.ConversationMetadata, projectID string) string {
+	template := p.templates.Conversation
+	if metadata.Project != "" {
+		template = p.templates.ProjectConversation
+	}
+
+	created := metadata.CreatedDate
+	return expandTemplate(template, map[string]string{
+		"platform": metadata.Platform,
+		"project":  p.projectName(projectID, metadata.Project),
+		"yyyy":     created.Format("2006"),
+		"mm":       created.Format("01"),
+		"dd":       created.Format("02"),
+		"date":     created.Format("2006-01-02"),
+		"slug":     pathValue(metadata.Title),
+		"id":       pathValue(metadata.ID),
+		"id8":      shortID(metadata.ID),
+	})
+}
+
+// projectDir returns the directory of a Claude project relative to the output
+// directory, claiming its name for the run
+func (p *Processor) projectDir(project models.ClaudeProject) string {
+	return expandTemplate(p.templates.Project, map[string]string{
+		"platform": "claude",
+		"project":  p.claimProjectName(project),
+		"id":       pathValue(project.UUID),
+		"id8":      shortID(project.UUID),
+	})
+}
+
+// mediaPath returns the path of a placed ChatGPT media file relative to the output directory
+func (p *Processor) mediaPath(folder, name string) string {
+	return expandTemplate(p.templates.Media, map[string]string{
+		"platform": "chatgpt",
+		"folder":   filepath.ToSlash(folder),
+		"name":     name,
+	})
+}
+
+// sanitizeProject sanitizes a project name, keeping it empty when there is no project
+func sanitizeProject(project string) string {
+	if project == "" {
+		return ""
+	}
+	return pathValue(project)
+}
+
+// pathValue sanitizes a placeholder value into a single path component, so that
+// a value such as ".." cannot leave the directory the template puts it in
+func pathValue(value string) string {
+	value = utils.SanitizeFilename(value)
+	if strings.Trim(value, ".") == "" {
+		return strings.Repeat("_", len(value))
+	}
+	return value
+}
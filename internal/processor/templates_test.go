@@ -0,0 +1,62 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/oisee/chat-transformer/internal/sink"
+)
+
+func TestProjectDirectoriesStayApartAndInside(t *testing.T) {
+	var archive bytes.Buffer
+	p, err := New(Options{
+		InputFS:    loadTestdata(t, "projects"),
+		Sink:       sink.NewZip(&archive),
+		ClaudeOnly: true,
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	names := zipNames(t, archive.Bytes())
+	// Two projects are named Tooling and one is named ".."
+	for _, prefix := range []string{
+		"claude/projects/Tooling/project.json",
+		"claude/projects/Tooling/2025-04-01_Chat 1_c0001",
+		"claude/projects/Tooling_p2/project.json",
+		"claude/projects/Tooling_p2/2025-04-01_Chat 2_c0002",
+		"claude/projects/__/project.json",
+		"claude/projects/__/2025-04-01_Chat 3_c0003",
+	} {
+		if !hasPrefix(names, prefix) {
+			t.Errorf("output is missing %s", prefix)
+		}
+	}
+	for name := range names {
+		if strings.HasSuffix(name, "project.json") && !strings.HasPrefix(name, "claude/projects/") {
+			t.Errorf("project written outside claude/projects: %s", name)
+		}
+	}
+}
+
+func TestPathValueStaysOneComponent(t *testing.T) {
+	for value, want := range map[string]string{
+		"..":        "__",
+		".":         "_",
+		"a/../b":    "a_.._b",
+		"Go Tools":  "Go Tools",
+		"...hidden": "...hidden",
+	} {
+		if got := pathValue(value); got != want {
+			t.Errorf("pathValue(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
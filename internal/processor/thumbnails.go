@@ -0,0 +1,185 @@
+package processor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"path/filepath"
+	"strings"
+
+	"github.com/oisee/chat-transformer/internal/models"
+)
+
+const (
+	// Maximum width or height of generated thumbnails in pixels
+	ThumbnailSize = 256
+
+	// Directory (inside the media directory) holding generated thumbnails
+	thumbnailsDir = "thumbnails"
+)
+
+// generateThumbnails creates downscaled thumbnails for the PNG, JPEG and GIF images
+// of the export and remembers where each one was written. It stops before the
+// next image when ctx is cancelled.
+func (p *Processor) generateThumbnails(ctx context.Context, mediaInfo *models.ChatGPTMediaInfo) error {
+	mediaBase := filepath.Join("chatgpt", "media")
+
+	groups := []struct {
+		folder string
+		files  []models.MediaFile
+	}{
+		{"images", mediaInfo.Images},
+		{"dalle-generations", mediaInfo.DalleGenerations},
+		{"user-uploads", mediaInfo.UserUploads},
+	}
+
+	created, skipped := 0, 0
+	for _, group := range groups {
+		for _, file := range group.files {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			relPath, ok := p.thumbnailPath(group.folder, file)
+			if !ok {
+				continue
+			}
+			thumbPath := filepath.Join(mediaBase, relPath)
+
+			// Keep thumbnails from earlier runs when the source has not changed
+			if info, err := p.statOutput(thumbPath); err == nil && !info.ModTime().Before(file.Modified) {
+				p.thumbnails[file.Path] = relPath
+				skipped++
+				continue
+			}
+
+			if err := p.writeThumbnail(file.Path, thumbPath, file.Format); err != nil {
+				p.logger.Warn("failed to create thumbnail", "path", file.Path, "error", err)
+				continue
+			}
+			p.thumbnails[file.Path] = relPath
+			created++
+		}
+	}
+
+	p.logger.Info("Created thumbnails", "count", created, "up_to_date", skipped)
+	return nil
+}
+
+// thumbnailPath returns the path, relative to the media directory, of the
+// thumbnail of an image in a media folder, or false for files without thumbnails
+func (p *Processor) thumbnailPath(folder string, file models.MediaFile) (string, bool) {
+	if file.Kind != "image" || (file.Format != "png" && file.Format != "jpeg" && file.Format != "gif") {
+		return "", false
+	}
+	return filepath.Join(thumbnailsDir, folder, p.thumbnailName(file)), true
+}
+
+// thumbnailName returns the thumbnail file name for an image, keeping JPEG
+// thumbnails as JPEG and writing PNG for everything else. A hash of the image's
+// path inside the input keeps images with the same name apart, such as x.png
+// and x.jpg or files of the same name in different folders.
+func (p *Processor) thumbnailName(file models.MediaFile) string {
+	base := strings.TrimSuffix(file.Name, filepath.Ext(file.Name))
+	sum := sha256.Sum256([]byte(p.input.Name(file.Path)))
+	base += "-" + hex.EncodeToString(sum[:4])
+	if file.Format == "jpeg" {
+		return base + ".jpg"
+	}
+	return base + ".png"
+}
+
+// writeThumbnail decodes an image of the input and writes a downscaled copy to
+// the output file dst
+func (p *Processor) writeThumbnail(src, dst, format string) error {
+	in, err := p.input.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var img image.Image
+	switch format {
+	case "png":
+		img, err = png.Decode(in)
+	case "jpeg":
+		img, err = jpeg.Decode(in)
+	case "gif":
+		img, err = gif.Decode(in) // first frame only
+	default:
+		return fmt.Errorf("unsupported image format %s", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	out, err := p.createOutput(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	thumb := downscale(img, ThumbnailSize)
+	if format == "jpeg" {
+		err = jpeg.Encode(out, thumb, &jpeg.Options{Quality: 80})
+	} else {
+		err = png.Encode(out, thumb)
+	}
+	if err != nil {
+		return err
+	}
+	return out.Commit()
+}
+
+// downscale shrinks an image to fit within maxSize x maxSize using box filtering.
+// Images that already fit are returned unchanged.
+func downscale(src image.Image, maxSize int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxSize && height <= maxSize {
+		return src
+	}
+
+	newWidth, newHeight := maxSize, maxSize
+	if width > height {
+		newHeight = max(1, height*maxSize/width)
+	} else {
+		newWidth = max(1, width*maxSize/height)
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, newWidth, newHeight))
+	for y := 0; y < newHeight; y++ {
+		y0 := bounds.Min.Y + y*height/newHeight
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*height/newHeight)
+		for x := 0; x < newWidth; x++ {
+			x0 := bounds.Min.X + x*width/newWidth
+			x1 := max(x0+1, bounds.Min.X+(x+1)*width/newWidth)
+
+			// Average the source pixels covered by this destination pixel
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBA64Model.Convert(src.At(sx, sy)).(color.NRGBA64)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					b += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,257 @@
+// Package redact replaces personal data and secrets in conversations with
+// placeholder tokens before they are written.
+package redact
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/oisee/chat-transformer/internal/models"
+)
+
+// Rule finds one kind of value to redact
+type Rule struct {
+	Name    string                  // names the placeholders, e.g. email for [EMAIL_1]
+	Pattern *regexp.Regexp          // when it has a capture group, only the first group is replaced
+	Valid   func(value string) bool // optional check that a match really is such a value
+}
+
+// Counts holds the number of values redacted per rule name
+type Counts map[string]int
+
+// Add adds the counts of other
+func (c Counts) Add(other Counts) {
+	for name, n := range other {
+		c[name] += n
+	}
+}
+
+// BuiltinRules returns the built-in detectors. Secrets come first and phone
+// numbers last, so the more specific rules see a value before looser ones do.
+func BuiltinRules() []Rule {
+	return []Rule{
+		{Name: "aws_access_key", Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+		{Name: "aws_secret_key", Pattern: regexp.MustCompile(`(?i)aws_secret_access_key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})`)},
+		{Name: "openai_key", Pattern: regexp.MustCompile(`\bsk-(?:proj-|svcacct-|admin-)?[A-Za-z0-9_-]{20,}`)},
+		{Name: "github_token", Pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`)},
+		{Name: "email", Pattern: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)},
+		{Name: "credit_card", Pattern: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), Valid: luhn},
+		{Name: "ip_address", Pattern: regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b|(?i:\b(?:[0-9a-f]{0,4}:){3,7}[0-9a-f]{1,4}\b)`), Valid: isIP},
+		{Name: "phone", Pattern: regexp.MustCompile(`\+\d{1,3}(?:[ .-]?\(?\d{1,4}\)?){2,5}|(?:\(\d{3}\)\s?|\b\d{3}[.-])\d{3}[.-]\d{4}\b`), Valid: isPhone},
+	}
+}
+
+// luhn reports whether the digits of value pass the Luhn checksum of card numbers
+func luhn(value string) bool {
+	sum, digits := 0, 0
+	for i := len(value) - 1; i >= 0; i-- {
+		c := value[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if digits%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return digits >= 13 && digits <= 19 && sum%10 == 0
+}
+
+// isIP reports whether value is an IPv4 or IPv6 address
+func isIP(value string) bool {
+	return net.ParseIP(value) != nil
+}
+
+// isPhone reports whether value has as many digits as a phone number
+func isPhone(value string) bool {
+	digits := 0
+	for _, c := range value {
+		if c >= '0' && c <= '9' {
+			digits++
+		}
+	}
+	return digits >= 7 && digits <= 15
+}
+
+// LoadRules reads redaction rules from a file with one rule per line: a name,
+// whitespace and a regular expression. Empty lines and lines starting with #
+// are ignored.
+func LoadRules(path string) ([]Rule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules []Rule
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		name, pattern, found := strings.Cut(text, " ")
+		if !found {
+			name, pattern, found = strings.Cut(text, "\t")
+		}
+		pattern = strings.TrimSpace(pattern)
+		if !found || pattern == "" {
+			return nil, fmt.Errorf("line %d: expected a name and a regular expression", line)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rules = append(rules, Rule{Name: name, Pattern: re})
+	}
+	return rules, scanner.Err()
+}
+
+// Redactor replaces the values found by its rules with placeholders such as
+// [EMAIL_1]. The same value always gets the same placeholder, so redacted
+// conversations still show where a value recurs. It is safe for concurrent use.
+type Redactor struct {
+	rules []Rule
+
+	mutex        sync.Mutex
+	placeholders map[string]string // rule name and value -> placeholder
+	numbers      map[string]int    // rule name -> values seen so far
+}
+
+// New returns a redactor applying rules in order
+func New(rules []Rule) *Redactor {
+	return &Redactor{
+		rules:        rules,
+		placeholders: make(map[string]string),
+		numbers:      make(map[string]int),
+	}
+}
+
+// RuleNames returns the names of the rules, in the order they are applied
+func (r *Redactor) RuleNames() []string {
+	names := make([]string, len(r.rules))
+	for i, rule := range r.rules {
+		names[i] = rule.Name
+	}
+	return names
+}
+
+// Redact replaces the values found in the title, topics, message content,
+// audio transcripts and message metadata of conv and returns how many were
+// replaced per rule
+func (r *Redactor) Redact(conv *models.Conversation) Counts {
+	counts := make(Counts)
+
+	conv.Metadata.Title = r.Text(conv.Metadata.Title, counts)
+	for i, topic := range conv.Metadata.Topics {
+		conv.Metadata.Topics[i] = r.Text(topic, counts)
+	}
+
+	for i := range conv.Messages {
+		message := &conv.Messages[i]
+		message.Content = r.Text(message.Content, counts)
+		for j := range message.Audio {
+			message.Audio[j].Transcript = r.Text(message.Audio[j].Transcript, counts)
+		}
+		if message.Metadata != nil {
+			message.Metadata = r.value(message.Metadata, counts).(map[string]interface{})
+		}
+	}
+	return counts
+}
+
+// RedactProject replaces the values found in the description and document
+// contents of a Claude project and returns how many were replaced per rule
+func (r *Redactor) RedactProject(project *models.ClaudeProject) Counts {
+	counts := make(Counts)
+
+	project.Description = r.Text(project.Description, counts)
+	for i := range project.Docs {
+		project.Docs[i].Content = r.Text(project.Docs[i].Content, counts)
+	}
+	return counts
+}
+
+// value redacts the strings inside a decoded JSON value
+func (r *Redactor) value(v interface{}, counts Counts) interface{} {
+	switch v := v.(type) {
+	case string:
+		return r.Text(v, counts)
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			redacted[key] = r.value(item, counts)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = r.value(item, counts)
+		}
+		return redacted
+	default:
+		return v
+	}
+}
+
+// Text applies every rule to s, adding the values it replaced to counts
+func (r *Redactor) Text(s string, counts Counts) string {
+	for _, rule := range r.rules {
+		s = r.apply(rule, s, counts)
+	}
+	return s
+}
+
+// apply replaces the matches of one rule
+func (r *Redactor) apply(rule Rule, s string, counts Counts) string {
+	matches := rule.Pattern.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+
+	var out strings.Builder
+	last := 0
+	for _, match := range matches {
+		start, end := match[0], match[1]
+		if len(match) > 2 && match[2] >= 0 {
+			start, end = match[2], match[3] // the first capture group
+		}
+		value := s[start:end]
+		if rule.Valid != nil && !rule.Valid(value) {
+			continue
+		}
+
+		out.WriteString(s[last:start])
+		out.WriteString(r.placeholder(rule.Name, value))
+		last = end
+		counts[rule.Name]++
+	}
+	out.WriteString(s[last:])
+	return out.String()
+}
+
+// placeholder returns the placeholder of a value, numbering new values per rule
+func (r *Redactor) placeholder(name, value string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	key := name + "\x00" + value
+	if placeholder, ok := r.placeholders[key]; ok {
+		return placeholder
+	}
+	r.numbers[name]++
+	placeholder := fmt.Sprintf("[%s_%d]", strings.ToUpper(name), r.numbers[name])
+	r.placeholders[key] = placeholder
+	return placeholder
+}
@@ -1,43 +1,116 @@
 package renderer
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"os"
+	"io"
+	"io/fs"
+	"log/slog"
 	"path/filepath"
 	"strings"
 	"sync"
 
-	"chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/sink"
 )
 
 const (
-	// Number of parallel workers for markdown rendering
-	MaxWorkers = 50
+	// DefaultWorkers is the number of parallel workers for markdown rendering
+	DefaultWorkers = 50
+
+	// FormatVersion identifies the markdown layout. Bump it whenever rendering
+	// changes so incremental runs re-render every file.
+	FormatVersion = 2
 )
 
 // MarkdownRenderer handles rendering JSON conversations to markdown
 type MarkdownRenderer struct {
-	outputPath string
+	output        sink.Tree
+	incremental   bool     // skip files whose markdown is newer than their JSON
+	conversations []string // conversation files to render, relative to the output root
+	projects      []string // project files to render, relative to the output root
+	filesSet      bool     // render the files above instead of scanning the default directories
+	workers       int
+	logger        *slog.Logger
 }
 
-// renderJob represents a file to be rendered
+// renderJob represents a file to be rendered. Paths are relative to the output root.
 type renderJob struct {
 	inputPath  string
 	outputPath string
 	jobType    string // "conversation" or "project"
 }
 
-// New creates a new markdown renderer instance
-func New(outputPath string) *MarkdownRenderer {
+// New creates a new markdown renderer instance reading and writing output
+func New(output sink.Tree) *MarkdownRenderer {
 	return &MarkdownRenderer{
-		outputPath: outputPath,
+		output:  output,
+		workers: DefaultWorkers,
+		logger:  slog.Default(),
 	}
 }
 
-// RenderAll renders all conversations and projects to markdown
-func (r *MarkdownRenderer) RenderAll() error {
-	fmt.Println("Rendering conversations and projects to markdown...")
+// SetLogger sets the logger that receives progress messages and warnings
+func (r *MarkdownRenderer) SetLogger(logger *slog.Logger) {
+	r.logger = logger
+}
+
+// SetWorkers sets the number of parallel rendering workers
+func (r *MarkdownRenderer) SetWorkers(workers int) {
+	if workers > 0 {
+		r.workers = workers
+	}
+}
+
+// SetIncremental sets whether to skip files whose markdown is already up to date
+func (r *MarkdownRenderer) SetIncremental(incremental bool) {
+	r.incremental = incremental
+}
+
+// SetFiles sets the conversation and project JSON files to render, relative to the
+// output directory, instead of scanning the default chats and projects directories
+func (r *MarkdownRenderer) SetFiles(conversations, projects []string) {
+	r.conversations = conversations
+	r.projects = projects
+	r.filesSet = true
+}
+
+// MarkdownPath maps a conversation or project JSON file, relative to the output
+// directory, to its markdown file. The directory below the platform gets a "-md"
+// suffix: claude/chats/2025/03/chat.json becomes claude/chats-md/2025/03/chat.md.
+func MarkdownPath(jsonPath string) string {
+	parts := strings.Split(filepath.ToSlash(jsonPath), "/")
+	switch {
+	case len(parts) >= 3:
+		parts[1] += "-md"
+	case len(parts) == 2:
+		parts[0] += "-md"
+	}
+	return filepath.FromSlash(strings.TrimSuffix(strings.Join(parts, "/"), ".json") + ".md")
+}
+
+// RenderAll renders all conversations and projects to markdown. When ctx is
+// cancelled, files being rendered are finished and the context's error is returned.
+func (r *MarkdownRenderer) RenderAll(ctx context.Context) error {
+	r.logger.Info("Rendering conversations and projects to markdown...")
+
+	if r.filesSet {
+		if err := r.renderFiles(ctx, r.conversations, "conversation"); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			r.logger.Warn("conversation rendering failed", "error", err)
+		}
+		if err := r.renderFiles(ctx, r.projects, "project"); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			r.logger.Warn("project rendering failed", "error", err)
+		}
+		r.logger.Info("Markdown rendering completed")
+		return nil
+	}
 
 	// Create markdown output directories
 	if err := r.createMarkdownDirectories(); err != nil {
@@ -45,24 +118,46 @@ func (r *MarkdownRenderer) RenderAll() error {
 	}
 
 	// Render Claude conversations
-	if err := r.renderClaudeConversations(); err != nil {
-		fmt.Printf("Warning: Claude conversation rendering failed: %v\n", err)
+	if err := r.renderClaudeConversations(ctx); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		r.logger.Warn("Claude conversation rendering failed", "error", err)
 	}
 
 	// Render Claude projects
-	if err := r.renderClaudeProjects(); err != nil {
-		fmt.Printf("Warning: Claude project rendering failed: %v\n", err)
+	if err := r.renderClaudeProjects(ctx); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		r.logger.Warn("Claude project rendering failed", "error", err)
 	}
 
 	// Render ChatGPT conversations
-	if err := r.renderChatGPTConversations(); err != nil {
-		fmt.Printf("Warning: ChatGPT conversation rendering failed: %v\n", err)
+	if err := r.renderChatGPTConversations(ctx); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		r.logger.Warn("ChatGPT conversation rendering failed", "error", err)
 	}
 
-	fmt.Println("✓ Markdown rendering completed")
+	r.logger.Info("Markdown rendering completed")
 	return nil
 }
 
+// renderFiles renders the given JSON files, relative to the output directory, in parallel
+func (r *MarkdownRenderer) renderFiles(ctx context.Context, files []string, jobType string) error {
+	jobs := make([]renderJob, 0, len(files))
+	for _, file := range files {
+		jobs = append(jobs, renderJob{
+			inputPath:  file,
+			outputPath: MarkdownPath(file),
+			jobType:    jobType,
+		})
+	}
+	return r.processJobsParallel(ctx, jobs)
+}
+
 // createMarkdownDirectories creates the markdown output directory structure
 func (r *MarkdownRenderer) createMarkdownDirectories() error {
 	dirs := []string{
@@ -73,8 +168,7 @@ func (r *MarkdownRenderer) createMarkdownDirectories() error {
 	}
 
 	for _, dir := range dirs {
-		fullPath := filepath.Join(r.outputPath, dir)
-		if err := os.MkdirAll(fullPath, 0755); err != nil {
+		if err := r.output.MkdirAll(dir); err != nil {
 			return err
 		}
 	}
@@ -83,12 +177,12 @@ func (r *MarkdownRenderer) createMarkdownDirectories() error {
 }
 
 // renderClaudeConversations renders all Claude conversation JSON files to markdown using parallel processing
-func (r *MarkdownRenderer) renderClaudeConversations() error {
-	chatsPath := filepath.Join(r.outputPath, "claude", "chats")
+func (r *MarkdownRenderer) renderClaudeConversations(ctx context.Context) error {
+	chatsPath := "claude/chats"
 	
 	// Collect all conversation files
 	var jobs []renderJob
-	err := filepath.Walk(chatsPath, func(path string, info os.FileInfo, err error) error {
+	err := fs.WalkDir(r.output, chatsPath, func(path string, entry fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -104,7 +198,7 @@ func (r *MarkdownRenderer) renderClaudeConversations() error {
 		}
 		
 		mdPath := strings.Replace(relPath, ".json", ".md", 1)
-		outputPath := filepath.Join(r.outputPath, "claude", "chats-md", mdPath)
+		outputPath := filepath.Join("claude", "chats-md", mdPath)
 
 		jobs = append(jobs, renderJob{
 			inputPath:  path,
@@ -120,16 +214,16 @@ func (r *MarkdownRenderer) renderClaudeConversations() error {
 	}
 
 	// Process jobs in parallel
-	return r.processJobsParallel(jobs)
+	return r.processJobsParallel(ctx, jobs)
 }
 
 // renderChatGPTConversations renders all ChatGPT conversation JSON files to markdown using parallel processing
-func (r *MarkdownRenderer) renderChatGPTConversations() error {
-	chatsPath := filepath.Join(r.outputPath, "chatgpt", "chats")
+func (r *MarkdownRenderer) renderChatGPTConversations(ctx context.Context) error {
+	chatsPath := "chatgpt/chats"
 	
 	// Collect all conversation files
 	var jobs []renderJob
-	err := filepath.Walk(chatsPath, func(path string, info os.FileInfo, err error) error {
+	err := fs.WalkDir(r.output, chatsPath, func(path string, entry fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -145,7 +239,7 @@ func (r *MarkdownRenderer) renderChatGPTConversations() error {
 		}
 		
 		mdPath := strings.Replace(relPath, ".json", ".md", 1)
-		outputPath := filepath.Join(r.outputPath, "chatgpt", "chats-md", mdPath)
+		outputPath := filepath.Join("chatgpt", "chats-md", mdPath)
 
 		jobs = append(jobs, renderJob{
 			inputPath:  path,
@@ -161,16 +255,16 @@ func (r *MarkdownRenderer) renderChatGPTConversations() error {
 	}
 
 	// Process jobs in parallel
-	return r.processJobsParallel(jobs)
+	return r.processJobsParallel(ctx, jobs)
 }
 
 // renderClaudeProjects renders all Claude project JSON files to markdown using parallel processing
-func (r *MarkdownRenderer) renderClaudeProjects() error {
-	projectsPath := filepath.Join(r.outputPath, "claude", "projects")
+func (r *MarkdownRenderer) renderClaudeProjects(ctx context.Context) error {
+	projectsPath := "claude/projects"
 	
 	// Collect all project files
 	var jobs []renderJob
-	err := filepath.Walk(projectsPath, func(path string, info os.FileInfo, err error) error {
+	err := fs.WalkDir(r.output, projectsPath, func(path string, entry fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -186,7 +280,7 @@ func (r *MarkdownRenderer) renderClaudeProjects() error {
 			return err
 		}
 		
-		outputPath := filepath.Join(r.outputPath, "claude", "projects-md", relPath, "project.md")
+		outputPath := filepath.Join("claude", "projects-md", relPath, "project.md")
 
 		jobs = append(jobs, renderJob{
 			inputPath:  path,
@@ -202,40 +296,47 @@ func (r *MarkdownRenderer) renderClaudeProjects() error {
 	}
 
 	// Process jobs in parallel
-	return r.processJobsParallel(jobs)
+	return r.processJobsParallel(ctx, jobs)
 }
 
 // renderConversationToMarkdown renders a conversation to markdown format
 func (r *MarkdownRenderer) renderConversationToMarkdown(conv models.Conversation, outputPath string) error {
-	file, err := os.Create(outputPath)
+	file, err := r.output.Create(filepath.ToSlash(outputPath))
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
+	r.RenderConversation(file, conv, outputPath)
+	return file.Commit()
+}
+
+// RenderConversation writes the markdown of a conversation to w. Links are made
+// relative to outputPath, the path the markdown is written to relative to the output root.
+func (r *MarkdownRenderer) RenderConversation(w io.Writer, conv models.Conversation, outputPath string) {
 	// Write conversation header
-	fmt.Fprintf(file, "# %s\n\n", conv.Metadata.Title)
-	fmt.Fprintf(file, "**Platform:** %s  \n", conv.Metadata.Platform)
-	fmt.Fprintf(file, "**Created:** %s  \n", conv.Metadata.CreatedDate.Format("2006-01-02 15:04:05"))
-	fmt.Fprintf(file, "**Last Modified:** %s  \n", conv.Metadata.LastModified.Format("2006-01-02 15:04:05"))
-	fmt.Fprintf(file, "**Messages:** %d  \n", conv.Metadata.MessageCount)
+	fmt.Fprintf(w, "# %s\n\n", conv.Metadata.Title)
+	fmt.Fprintf(w, "**Platform:** %s  \n", conv.Metadata.Platform)
+	fmt.Fprintf(w, "**Created:** %s  \n", conv.Metadata.CreatedDate.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(w, "**Last Modified:** %s  \n", conv.Metadata.LastModified.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(w, "**Messages:** %d  \n", conv.Metadata.MessageCount)
 	if len(conv.Metadata.Participants) > 0 {
-		fmt.Fprintf(file, "**Participants:** %s  \n", strings.Join(conv.Metadata.Participants, ", "))
+		fmt.Fprintf(w, "**Participants:** %s  \n", strings.Join(conv.Metadata.Participants, ", "))
 	}
 	if conv.Metadata.Project != "" {
-		fmt.Fprintf(file, "**Project:** %s  \n", conv.Metadata.Project)
+		fmt.Fprintf(w, "**Project:** %s  \n", conv.Metadata.Project)
 	}
 	if len(conv.Metadata.Topics) > 0 {
-		fmt.Fprintf(file, "**Topics:** %s  \n", strings.Join(conv.Metadata.Topics, ", "))
+		fmt.Fprintf(w, "**Topics:** %s  \n", strings.Join(conv.Metadata.Topics, ", "))
 	}
-	fmt.Fprintf(file, "**Has Code:** %v  \n", conv.Metadata.HasCode)
-	fmt.Fprintf(file, "**Has Media:** %v  \n", conv.Metadata.HasMedia)
-	fmt.Fprintf(file, "\n---\n\n")
+	fmt.Fprintf(w, "**Has Code:** %v  \n", conv.Metadata.HasCode)
+	fmt.Fprintf(w, "**Has Media:** %v  \n", conv.Metadata.HasMedia)
+	fmt.Fprintf(w, "\n---\n\n")
 
 	// Write messages
 	if conv.Messages == nil || len(conv.Messages) == 0 {
-		fmt.Fprintf(file, "*No messages in this conversation.*\n")
-		return nil
+		fmt.Fprintf(w, "*No messages in this conversation.*\n")
+		return
 	}
 
 	for i, msg := range conv.Messages {
@@ -257,7 +358,7 @@ func (r *MarkdownRenderer) renderConversationToMarkdown(conv models.Conversation
 		}
 
 		// Write message separator with inline timestamp
-		fmt.Fprintf(file, "%s    *%s*\n\n", roleSeparator, msg.Timestamp.Format("2006-01-02 15:04:05"))
+		fmt.Fprintf(w, "%s    *%s*\n\n", roleSeparator, msg.Timestamp.Format("2006-01-02 15:04:05"))
 
 		// Write message content
 		content := strings.TrimSpace(msg.Content)
@@ -266,47 +367,78 @@ func (r *MarkdownRenderer) renderConversationToMarkdown(conv models.Conversation
 		}
 
 		// Format content for markdown (escape if needed, preserve code blocks)
-		fmt.Fprintf(file, "%s\n", content)
+		fmt.Fprintf(w, "%s\n", content)
+
+		// Link voice-mode audio clips with their transcripts
+		if len(msg.Audio) > 0 {
+			fmt.Fprintf(w, "\n")
+			for _, clip := range msg.Audio {
+				fmt.Fprintf(w, "%s\n", r.formatAudioClip(clip, outputPath))
+			}
+		}
 
 		// Add spacing between messages (except for the last one)
 		if i < len(conv.Messages)-1 {
-			fmt.Fprintf(file, "\n")
+			fmt.Fprintf(w, "\n")
 		}
 	}
+}
 
-	return nil
+// formatAudioClip formats an audio clip as a markdown line linking to the audio
+// file. The transcript is the message content, so it is not repeated.
+func (r *MarkdownRenderer) formatAudioClip(clip models.AudioClip, outputPath string) string {
+	label := clip.FileID
+	if clip.Path != "" {
+		if link, err := filepath.Rel(filepath.Dir(outputPath), clip.Path); err == nil {
+			label = fmt.Sprintf("[%s](<%s>)", clip.FileID, filepath.ToSlash(link))
+		}
+	}
+
+	line := fmt.Sprintf("- 🔊 %s", label)
+	if clip.Start != nil && clip.End != nil {
+		line += fmt.Sprintf(" (%.1fs–%.1fs)", *clip.Start, *clip.End)
+	} else if clip.Start != nil {
+		line += fmt.Sprintf(" (from %.1fs)", *clip.Start)
+	}
+	return line
 }
 
 // renderProjectToMarkdown renders a project to markdown format
 func (r *MarkdownRenderer) renderProjectToMarkdown(project models.ClaudeProject, outputPath string) error {
-	file, err := os.Create(outputPath)
+	file, err := r.output.Create(filepath.ToSlash(outputPath))
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
+	RenderProject(file, project)
+	return file.Commit()
+}
+
+// RenderProject writes the markdown of a Claude project to w
+func RenderProject(w io.Writer, project models.ClaudeProject) {
 	// Write project header
-	fmt.Fprintf(file, "# %s\n\n", project.Name)
-	fmt.Fprintf(file, "**UUID:** %s  \n", project.UUID)
-	fmt.Fprintf(file, "**Created:** %s  \n", project.CreatedAt)
-	fmt.Fprintf(file, "**Updated:** %s  \n", project.UpdatedAt)
-	fmt.Fprintf(file, "**Documents:** %d  \n", len(project.Docs))
-	fmt.Fprintf(file, "\n## Description\n\n")
+	fmt.Fprintf(w, "# %s\n\n", project.Name)
+	fmt.Fprintf(w, "**UUID:** %s  \n", project.UUID)
+	fmt.Fprintf(w, "**Created:** %s  \n", project.CreatedAt)
+	fmt.Fprintf(w, "**Updated:** %s  \n", project.UpdatedAt)
+	fmt.Fprintf(w, "**Documents:** %d  \n", len(project.Docs))
+	fmt.Fprintf(w, "\n## Description\n\n")
 	
 	if project.Description != "" {
-		fmt.Fprintf(file, "%s\n\n", project.Description)
+		fmt.Fprintf(w, "%s\n\n", project.Description)
 	} else {
-		fmt.Fprintf(file, "*No description provided.*\n\n")
+		fmt.Fprintf(w, "*No description provided.*\n\n")
 	}
 
 	// Write documents section
 	if len(project.Docs) > 0 {
-		fmt.Fprintf(file, "## Project Documents\n\n")
+		fmt.Fprintf(w, "## Project Documents\n\n")
 		
 		for i, doc := range project.Docs {
-			fmt.Fprintf(file, "### %d. %s\n\n", i+1, doc.Filename)
+			fmt.Fprintf(w, "### %d. %s\n\n", i+1, doc.Filename)
 			if doc.CreatedAt != "" {
-				fmt.Fprintf(file, "**Created:** %s  \n\n", doc.CreatedAt)
+				fmt.Fprintf(w, "**Created:** %s  \n\n", doc.CreatedAt)
 			}
 			
 			content := strings.TrimSpace(doc.Content)
@@ -314,20 +446,36 @@ func (r *MarkdownRenderer) renderProjectToMarkdown(project models.ClaudeProject,
 				content = "*[Empty document]*"
 			}
 			
-			fmt.Fprintf(file, "%s\n\n", content)
+			fmt.Fprintf(w, "%s\n\n", content)
 			
 			if i < len(project.Docs)-1 {
-				fmt.Fprintf(file, "---\n\n")
+				fmt.Fprintf(w, "---\n\n")
 			}
 		}
 	}
-
-	return nil
 }
 
-// processJobsParallel processes render jobs using a worker pool
-func (r *MarkdownRenderer) processJobsParallel(jobs []renderJob) error {
+// processJobsParallel processes render jobs using a worker pool. Once ctx is
+// cancelled no new jobs are started and the context's error is returned.
+func (r *MarkdownRenderer) processJobsParallel(ctx context.Context, jobs []renderJob) error {
+	// Only re-render files whose JSON changed since the markdown was written
+	upToDate := 0
+	if r.incremental {
+		pending := jobs[:0]
+		for _, job := range jobs {
+			if r.isUpToDate(job) {
+				upToDate++
+				continue
+			}
+			pending = append(pending, job)
+		}
+		jobs = pending
+	}
+
 	if len(jobs) == 0 {
+		if upToDate > 0 {
+			r.logger.Info("Markdown files up to date", "count", upToDate)
+		}
 		return nil
 	}
 
@@ -336,7 +484,7 @@ func (r *MarkdownRenderer) processJobsParallel(jobs []renderJob) error {
 	resultChan := make(chan error, len(jobs))
 
 	// Determine number of workers (don't exceed job count)
-	numWorkers := MaxWorkers
+	numWorkers := r.workers
 	if len(jobs) < numWorkers {
 		numWorkers = len(jobs)
 	}
@@ -345,7 +493,7 @@ func (r *MarkdownRenderer) processJobsParallel(jobs []renderJob) error {
 	var wg sync.WaitGroup
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
-		go r.worker(&wg, jobChan, resultChan)
+		go r.worker(ctx, &wg, jobChan, resultChan)
 	}
 
 	// Send jobs to workers
@@ -358,42 +506,57 @@ func (r *MarkdownRenderer) processJobsParallel(jobs []renderJob) error {
 	wg.Wait()
 	close(resultChan)
 
-	// Check for errors
-	var errors []error
+	// Count errors; workers already logged them, rendering does not fail completely
+	failed := 0
 	for err := range resultChan {
 		if err != nil {
-			errors = append(errors, err)
+			failed++
 		}
 	}
 
-	if len(errors) > 0 {
-		// Log warnings but don't fail completely
-		for _, err := range errors {
-			fmt.Printf("Warning: markdown rendering error: %v\n", err)
-		}
+	if failed > 0 {
+		r.logger.Warn("files failed to render to markdown", "count", failed)
 	}
-
-	fmt.Printf("✓ Rendered %d files to markdown using %d workers\n", len(jobs), numWorkers)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.logger.Info("Rendered markdown files", "count", len(jobs)-failed, "workers", numWorkers, "up_to_date", upToDate)
 	return nil
 }
 
+// isUpToDate reports whether a job's markdown exists and is not older than its JSON
+func (r *MarkdownRenderer) isUpToDate(job renderJob) bool {
+	input, err := fs.Stat(r.output, filepath.ToSlash(job.inputPath))
+	if err != nil {
+		return false
+	}
+	output, err := fs.Stat(r.output, filepath.ToSlash(job.outputPath))
+	if err != nil {
+		return false
+	}
+	return !output.ModTime().Before(input.ModTime())
+}
+
 // worker processes render jobs from the job channel
-func (r *MarkdownRenderer) worker(wg *sync.WaitGroup, jobChan <-chan renderJob, resultChan chan<- error) {
+func (r *MarkdownRenderer) worker(ctx context.Context, wg *sync.WaitGroup, jobChan <-chan renderJob, resultChan chan<- error) {
 	defer wg.Done()
 
 	for job := range jobChan {
+		// Drain queued jobs without starting them once cancelled
+		if ctx.Err() != nil {
+			continue
+		}
+
 		err := r.processJob(job)
+		if err != nil {
+			r.logger.Warn("markdown rendering failed", "path", job.inputPath, "error", err)
+		}
 		resultChan <- err
 	}
 }
 
 // processJob processes a single render job
 func (r *MarkdownRenderer) processJob(job renderJob) error {
-	// Ensure output directory exists
-	if err := os.MkdirAll(filepath.Dir(job.outputPath), 0755); err != nil {
-		return fmt.Errorf("failed to create directory for %s: %w", job.outputPath, err)
-	}
-
 	switch job.jobType {
 	case "conversation":
 		var conv models.Conversation
@@ -414,11 +577,11 @@ func (r *MarkdownRenderer) processJob(job renderJob) error {
 	}
 }
 
-// readJSON reads and unmarshals a JSON file
+// readJSON reads and unmarshals a JSON file of the output
 func (r *MarkdownRenderer) readJSON(path string, v interface{}) error {
-	data, err := os.ReadFile(path)
+	data, err := fs.ReadFile(r.output, filepath.ToSlash(path))
 	if err != nil {
 		return err
 	}
 	return json.Unmarshal(data, v)
-}
\ No newline at end of file
+}
@@ -0,0 +1,221 @@
+// Package sink writes a finished output tree to its destination: a directory,
+// a tar.gz archive or a zip archive.
+package sink
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oisee/chat-transformer/internal/utils"
+)
+
+// Sink receives the files of an output tree
+type Sink interface {
+	// WriteFile adds a file of size bytes read from r. Name is slash-separated
+	// and relative to the root of the output.
+	WriteFile(name string, size int64, modTime time.Time, r io.Reader) error
+
+	// Close finishes the output. Sinks returned by NewTarGz and NewZip do not
+	// close the writer they were created with.
+	Close() error
+}
+
+// Export writes every regular file of fsys to sink, in lexical order. Symbolic
+// links are followed, so linked media is stored with its content. A non-zero
+// modTime replaces the modification time of every file, for reproducible archives.
+func Export(fsys fs.FS, sink Sink, modTime time.Time) error {
+	return fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		info, err := fs.Stat(fsys, name) // follows symbolic links
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		fileTime := info.ModTime()
+		if !modTime.IsZero() {
+			fileTime = modTime
+		}
+		if err := sink.WriteFile(name, info.Size(), fileTime, file); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		return nil
+	})
+}
+
+// New returns the sink for path, chosen by its extension: .tar.gz or .tgz for a
+// tar.gz archive, .zip for a zip archive and a directory otherwise. Archive files
+// are created on the first write and only appear under path once the sink is closed.
+func New(path string) Sink {
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return &archiveFile{path: path, newArchive: NewTarGz}
+	case strings.HasSuffix(lower, ".zip"):
+		return &archiveFile{path: path, newArchive: NewZip}
+	default:
+		return NewDirectory(path)
+	}
+}
+
+// archiveFile is an archive sink writing to a file that is committed on Close
+type archiveFile struct {
+	path       string
+	newArchive func(io.Writer) Sink
+	file       *utils.AtomicFile
+	archive    Sink
+}
+
+// open creates the archive file on first use
+func (a *archiveFile) open() error {
+	if a.file != nil {
+		return nil
+	}
+	file, err := utils.CreateAtomic(a.path)
+	if err != nil {
+		return err
+	}
+	a.file = file
+	a.archive = a.newArchive(file)
+	return nil
+}
+
+func (a *archiveFile) WriteFile(name string, size int64, modTime time.Time, r io.Reader) error {
+	if err := a.open(); err != nil {
+		return err
+	}
+	return a.archive.WriteFile(name, size, modTime, r)
+}
+
+func (a *archiveFile) Close() error {
+	if err := a.open(); err != nil {
+		return err
+	}
+	defer a.file.Close()
+	if err := a.archive.Close(); err != nil {
+		return err
+	}
+	return a.file.Commit()
+}
+
+// directory writes files below a directory
+type directory struct {
+	root string
+}
+
+// NewDirectory returns a sink that writes files below root
+func NewDirectory(root string) Sink {
+	return &directory{root: root}
+}
+
+func (d *directory) WriteFile(name string, size int64, modTime time.Time, r io.Reader) error {
+	path := filepath.Join(d.root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	file, err := utils.CreateAtomic(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, r); err != nil {
+		return err
+	}
+	if err := file.Commit(); err != nil {
+		return err
+	}
+	return os.Chtimes(path, modTime, modTime)
+}
+
+func (d *directory) Close() error {
+	return nil
+}
+
+// tarGz writes files to a gzip-compressed tar archive
+type tarGz struct {
+	gzip *gzip.Writer
+	tar  *tar.Writer
+}
+
+// NewTarGz returns a sink that writes a tar.gz archive to w
+func NewTarGz(w io.Writer) Sink {
+	gz := gzip.NewWriter(w)
+	return &tarGz{gzip: gz, tar: tar.NewWriter(gz)}
+}
+
+func (t *tarGz) WriteFile(name string, size int64, modTime time.Time, r io.Reader) error {
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  modTime.UTC().Truncate(time.Second),
+		Format:   tar.FormatPAX,
+	}
+	if err := t.tar.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.CopyN(t.tar, r, size)
+	return err
+}
+
+func (t *tarGz) Close() error {
+	if err := t.tar.Close(); err != nil {
+		return err
+	}
+	return t.gzip.Close()
+}
+
+// zipArchive writes files to a zip archive
+type zipArchive struct {
+	zip *zip.Writer
+}
+
+// NewZip returns a sink that writes a zip archive to w
+func NewZip(w io.Writer) Sink {
+	return &zipArchive{zip: zip.NewWriter(w)}
+}
+
+func (z *zipArchive) WriteFile(name string, size int64, modTime time.Time, r io.Reader) error {
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modTime.UTC(),
+	}
+	header.SetMode(0644)
+
+	w, err := z.zip.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(w, r, size)
+	return err
+}
+
+func (z *zipArchive) Close() error {
+	return z.zip.Close()
+}
@@ -0,0 +1,155 @@
+package sink
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"testing/fstest"
+	"time"
+
+	"github.com/oisee/chat-transformer/internal/utils"
+)
+
+// Tree is the output tree a run builds. Files are written atomically and can be
+// read back, which incremental runs and markdown rendering rely on. Names are
+// slash-separated and relative to the root of the tree, as in io/fs.
+type Tree interface {
+	fs.StatFS
+
+	// Create starts writing the file name, creating its parent directories. The
+	// file replaces any existing one on Commit; Close without Commit discards it.
+	Create(name string) (File, error)
+
+	// MkdirAll creates the directory name and any missing parents
+	MkdirAll(name string) error
+
+	// Remove deletes the file name. It is not an error if it does not exist.
+	Remove(name string) error
+}
+
+// File is a file of a Tree being written
+type File interface {
+	io.Writer
+	Commit() error
+	Close() error
+}
+
+// dirTree is a tree in a directory on disk
+type dirTree struct {
+	fs.StatFS
+	root string
+}
+
+// NewDirTree returns the tree in the directory root
+func NewDirTree(root string) Tree {
+	return &dirTree{StatFS: os.DirFS(root).(fs.StatFS), root: root}
+}
+
+// path returns the path on disk of the file name
+func (d *dirTree) path(name string) string {
+	return filepath.Join(d.root, filepath.FromSlash(name))
+}
+
+func (d *dirTree) Create(name string) (File, error) {
+	path := d.path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := utils.CreateAtomic(path)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (d *dirTree) MkdirAll(name string) error {
+	return os.MkdirAll(d.path(name), 0755)
+}
+
+func (d *dirTree) Remove(name string) error {
+	err := os.Remove(d.path(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// memoryTree is a tree held in memory
+type memoryTree struct {
+	mutex sync.Mutex // protects files
+	files fstest.MapFS
+}
+
+// NewMemoryTree returns an empty tree held in memory, for runs whose output only
+// goes to a sink
+func NewMemoryTree() Tree {
+	return &memoryTree{files: make(fstest.MapFS)}
+}
+
+// Open opens a file or directory. Files are never changed once committed, so
+// they can be read after the lock is released.
+func (m *memoryTree) Open(name string) (fs.File, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.files.Open(name)
+}
+
+func (m *memoryTree) Stat(name string) (fs.FileInfo, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.files.Stat(name)
+}
+
+func (m *memoryTree) Create(name string) (File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrInvalid}
+	}
+	return &memoryFile{tree: m, name: name}, nil
+}
+
+func (m *memoryTree) MkdirAll(name string) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for dir := name; dir != "."; dir = path.Dir(dir) {
+		if _, ok := m.files[dir]; !ok {
+			m.files[dir] = &fstest.MapFile{Mode: fs.ModeDir | 0755, ModTime: time.Now()}
+		}
+	}
+	return nil
+}
+
+func (m *memoryTree) Remove(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.files, name)
+	return nil
+}
+
+// memoryFile is a file of a memoryTree being written
+type memoryFile struct {
+	bytes.Buffer
+	tree *memoryTree
+	name string
+}
+
+func (f *memoryFile) Commit() error {
+	f.tree.mutex.Lock()
+	defer f.tree.mutex.Unlock()
+	f.tree.files[f.name] = &fstest.MapFile{
+		Data:    bytes.Clone(f.Bytes()),
+		Mode:    0644,
+		ModTime: time.Now(),
+	}
+	return nil
+}
+
+func (f *memoryFile) Close() error {
+	return nil
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// AtomicFile is written under a temporary name next to its destination and only
+// renamed into place by Commit, so an interrupted run never leaves a truncated file
+type AtomicFile struct {
+	*os.File
+	path      string
+	committed bool
+}
+
+// CreateAtomic starts writing the file at path. Callers must call Commit once the
+// content is complete; Close without Commit discards the temporary file.
+func CreateAtomic(path string) (*AtomicFile, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	return &AtomicFile{File: file, path: path}, nil
+}
+
+// Commit closes the temporary file and renames it over the destination
+func (f *AtomicFile) Commit() error {
+	if err := f.File.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	f.committed = true
+	return nil
+}
+
+// Close discards the temporary file unless it was committed. It is safe to defer.
+func (f *AtomicFile) Close() error {
+	if f.committed {
+		return nil
+	}
+	f.committed = true // only clean up once
+	f.File.Close()
+	return os.Remove(f.Name())
+}
+
+// WriteFileAtomic writes data to path through a temporary file and a rename
+func WriteFileAtomic(path string, data []byte) error {
+	file, err := CreateAtomic(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+	return file.Commit()
+}
@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Log formats accepted by SetupLogging
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// SetupLogging installs the default logger. Text logs are written for people
+// reading a terminal, JSON logs as one object per line.
+func SetupLogging(w io.Writer, level, format string) error {
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q (expected debug, info, warn or error)", level)
+	}
+
+	var handler slog.Handler
+	switch format {
+	case LogFormatText:
+		handler = NewTextHandler(w, logLevel)
+	case LogFormatJSON:
+		handler = slog.NewJSONHandler(w, &slog.HandlerOptions{Level: logLevel})
+	default:
+		return fmt.Errorf("invalid log format %q (expected %s or %s)", format, LogFormatText, LogFormatJSON)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// TextHandler writes log records as a message followed by key=value fields,
+// prefixing everything but informational messages with the level
+type TextHandler struct {
+	w      io.Writer
+	level  slog.Leveler
+	attrs  string // preformatted fields added with WithAttrs
+	prefix string // group prefix for field keys
+	mutex  *sync.Mutex
+}
+
+// NewTextHandler creates a text handler that writes records at or above level
+func NewTextHandler(w io.Writer, level slog.Leveler) *TextHandler {
+	return &TextHandler{w: w, level: level, mutex: &sync.Mutex{}}
+}
+
+// Enabled reports whether records at level are written
+func (h *TextHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle writes a record
+func (h *TextHandler) Handle(_ context.Context, record slog.Record) error {
+	var b strings.Builder
+	switch {
+	case record.Level >= slog.LevelError:
+		b.WriteString("Error: ")
+	case record.Level >= slog.LevelWarn:
+		b.WriteString("Warning: ")
+	case record.Level < slog.LevelInfo:
+		b.WriteString("Debug: ")
+	}
+	b.WriteString(formatRecord(record, h.attrs, h.prefix))
+	b.WriteByte('\n')
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+// WithAttrs returns a handler that adds attrs to every record
+func (h *TextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	var b strings.Builder
+	b.WriteString(h.attrs)
+	for _, attr := range attrs {
+		appendAttr(&b, h.prefix, attr)
+	}
+	clone.attrs = b.String()
+	return &clone
+}
+
+// WithGroup returns a handler that qualifies field keys with name
+func (h *TextHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+// formatRecord formats a record's message and fields without the level
+func formatRecord(record slog.Record, attrs, prefix string) string {
+	var b strings.Builder
+	b.WriteString(record.Message)
+	b.WriteString(attrs)
+	record.Attrs(func(attr slog.Attr) bool {
+		appendAttr(&b, prefix, attr)
+		return true
+	})
+	return b.String()
+}
+
+// appendAttr writes " key=value", quoting values that contain spaces or quotes
+func appendAttr(b *strings.Builder, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		for _, member := range attr.Value.Group() {
+			appendAttr(b, prefix+attr.Key+".", member)
+		}
+		return
+	}
+
+	value := attr.Value.String()
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		value = strconv.Quote(value)
+	}
+	b.WriteByte(' ')
+	b.WriteString(prefix + attr.Key)
+	b.WriteByte('=')
+	b.WriteString(value)
+}
+
+// NewWarningCollector returns a handler that passes every warning and error to
+// collect, e.g. for the transformation report, before handing records to next.
+// Warnings are collected even when next's level hides them.
+func NewWarningCollector(next slog.Handler, collect func(message string)) slog.Handler {
+	return &warningCollector{next: next, collect: collect}
+}
+
+// warningCollector is a handler that passes warnings to a function before
+// handing records to the next handler
+type warningCollector struct {
+	next    slog.Handler
+	collect func(message string)
+	attrs   string
+	prefix  string
+}
+
+func (h *warningCollector) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelWarn || h.next.Enabled(ctx, level)
+}
+
+func (h *warningCollector) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level >= slog.LevelWarn {
+		h.collect(formatRecord(record, h.attrs, h.prefix))
+	}
+	if !h.next.Enabled(ctx, record.Level) {
+		return nil
+	}
+	return h.next.Handle(ctx, record)
+}
+
+func (h *warningCollector) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.next = h.next.WithAttrs(attrs)
+	var b strings.Builder
+	b.WriteString(h.attrs)
+	for _, attr := range attrs {
+		appendAttr(&b, h.prefix, attr)
+	}
+	clone.attrs = b.String()
+	return &clone
+}
+
+func (h *warningCollector) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.next = h.next.WithGroup(name)
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
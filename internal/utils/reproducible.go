@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// SourceDateEpochVariable names the environment variable that fixes the
+// timestamps of reproducible output (see https://reproducible-builds.org/specs/source-date-epoch/)
+const SourceDateEpochVariable = "SOURCE_DATE_EPOCH"
+
+// SourceDateEpoch returns the time set by SOURCE_DATE_EPOCH in seconds since the
+// Unix epoch, or the Unix epoch itself when the variable is not set
+func SourceDateEpoch() (time.Time, error) {
+	value := os.Getenv(SourceDateEpochVariable)
+	if value == "" {
+		return time.Unix(0, 0).UTC(), nil
+	}
+
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return time.Time{}, fmt.Errorf("invalid %s %q (expected a non-negative number of seconds)", SourceDateEpochVariable, value)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
@@ -1,13 +1,26 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
 
-	"chat-transformer/internal/processor"
+	"github.com/oisee/chat-transformer/internal/export"
+	"github.com/oisee/chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/parser"
+	"github.com/oisee/chat-transformer/internal/processor"
+	"github.com/oisee/chat-transformer/internal/redact"
+	"github.com/oisee/chat-transformer/internal/renderer"
+	"github.com/oisee/chat-transformer/internal/sink"
+	"github.com/oisee/chat-transformer/internal/utils"
 )
 
 // Build-time variables (set by Makefile)
@@ -19,13 +32,44 @@ var (
 
 func main() {
 	var (
-		inputFolder     string
-		outputFolder    string
-		showVersion     bool
-		copyMedia       bool
-		claudeOnly      bool
-		chatgptOnly     bool
-		renderMarkdown  bool
+		inputFolder      string
+		outputFolder     string
+		archivePath      string
+		format           string
+		ndjsonMessages   bool
+		gzipExport       bool
+		csvMaxContent    int
+		fineTune         export.FineTuneOptions
+		showVersion      bool
+		copyMedia        bool
+		mediaMode        string
+		contentAddressed bool
+		claudeOnly       bool
+		chatgptOnly      bool
+		renderMarkdown   bool
+		gallery          bool
+		fullRebuild      bool
+		staging          bool
+		dryRun           bool
+		planFile         string
+		since            string
+		until            string
+		projects         string
+		titleMatch       string
+		minMessages      int
+		idsFile          string
+		redactData       bool
+		redactRules      string
+		templates        = processor.DefaultPathTemplates()
+		configFile       string
+		profile          string
+		printConfig      bool
+		logLevel         string
+		logFormat        string
+		resume           bool
+		reproducible     bool
+		workers          int
+		renderWorkers    int
 	)
 
 	// Parse command line arguments
@@ -36,11 +80,22 @@ func main() {
 	flag.StringVar(&outputFolder, "o", "", "Output folder path")
 	flag.StringVar(&outputFolder, "output", "", "Output folder path")
 	flag.StringVar(&outputFolder, "output-folder", "", "Output folder path")
+	flag.StringVar(&format, "format", FormatExpanded, "Output format: expanded (folders of JSON files), ndjson (conversations.ndjson), csv (conversations.csv and messages.csv), or openai or anthropic (fine-tuning examples in <format>.jsonl); use -o - to write a single-file export to stdout")
+	flag.BoolVar(&ndjsonMessages, "ndjson-messages", false, "With --format ndjson, write messages to messages.ndjson with their conversation ID instead of inside each conversation")
+	flag.IntVar(&csvMaxContent, "csv-max-content", 0, "With --format csv, cut message content to this many characters (e.g. 32767 for spreadsheets; 0 keeps it whole)")
+	flag.BoolVar(&fineTune.KeepSystem, "finetune-keep-system", false, "With --format openai or anthropic, keep system turns")
+	flag.BoolVar(&fineTune.KeepTool, "finetune-keep-tool", false, "With --format openai or anthropic, keep tool output")
+	flag.IntVar(&fineTune.MaxTurns, "finetune-max-turns", 0, "With --format openai or anthropic, most turns per example (0 for no limit)")
+	flag.IntVar(&fineTune.MaxCharacters, "finetune-max-chars", 0, "With --format openai or anthropic, most characters per example (0 for no limit)")
+	flag.BoolVar(&gzipExport, "gzip", false, "Compress exported files with gzip")
+	flag.StringVar(&archivePath, "archive", "", "Also write the output to this .tar.gz, .tgz or .zip archive (without an output folder, only the archive is written)")
 	
 	flag.BoolVar(&showVersion, "version", false, "Show version information")
 	flag.BoolVar(&showVersion, "v", false, "Show version information")
 	
 	flag.BoolVar(&copyMedia, "copy-media", false, "Copy media files to output directory (default: false, only store references)")
+	flag.StringVar(&mediaMode, "media-mode", "", "How media is placed in the output: reference, copy, hardlink or symlink (default: reference, or copy with --copy-media)")
+	flag.BoolVar(&contentAddressed, "content-addressed", false, "Store placed media by SHA-256 hash, adding only new content (requires --copy-media or --media-mode)")
 	
 	flag.BoolVar(&claudeOnly, "claude", false, "Process only Claude conversations")
 	flag.BoolVar(&claudeOnly, "c", false, "Process only Claude conversations")
@@ -51,9 +106,60 @@ func main() {
 	
 	flag.BoolVar(&renderMarkdown, "render-markdown", false, "Render JSON conversations to readable markdown files")
 	flag.BoolVar(&renderMarkdown, "md", false, "Render JSON conversations to readable markdown files")
+
+	flag.BoolVar(&gallery, "gallery", false, "Create image thumbnails and an HTML media gallery (chatgpt/media/gallery.html)")
+
+	flag.BoolVar(&fullRebuild, "full-rebuild", false, "Ignore the processing manifest and rewrite every conversation")
+	flag.BoolVar(&staging, "staging", false, "Build the output in a staging directory and swap it into place only when the run succeeds")
+	flag.BoolVar(&resume, "resume", false, "Continue an interrupted run from its checkpoint, skipping conversations it already wrote")
+	flag.BoolVar(&reproducible, "reproducible", false, "Produce byte-identical output for identical input, stamping generated files with $SOURCE_DATE_EPOCH (default: the Unix epoch)")
+
+	flag.BoolVar(&dryRun, "dry-run", false, "Parse the exports and show what would be written without writing anything")
+	flag.StringVar(&planFile, "plan", "", "Write the dry-run plan as JSON to this file (implies --dry-run)")
+
+	flag.StringVar(&since, "since", "", "Only process conversations created on or after this date (YYYY-MM-DD or RFC 3339)")
+	flag.StringVar(&until, "until", "", "Only process conversations created on or before this date (YYYY-MM-DD or RFC 3339)")
+	flag.StringVar(&projects, "project", "", "Only process conversations in these projects (comma-separated)")
+	flag.StringVar(&titleMatch, "title-match", "", "Only process conversations whose title matches this regular expression")
+	flag.IntVar(&minMessages, "min-messages", 0, "Only process conversations with at least this many messages")
+	flag.BoolVar(&redactData, "redact", false, "Replace emails, phone numbers, card numbers, IP addresses and API keys in conversations with placeholders and write redaction_report.json")
+	flag.StringVar(&redactRules, "redact-rules", "", "Also redact the patterns in this file (one per line: a name and a regular expression; implies --redact)")
+	flag.StringVar(&idsFile, "ids-file", "", "Only process the conversation IDs listed in this file (one per line)")
+
+	flag.StringVar(&templates.Conversation, "conversation-template", templates.Conversation, "Output path template for conversations outside projects")
+	flag.StringVar(&templates.ProjectConversation, "project-conversation-template", templates.ProjectConversation, "Output path template for conversations in projects")
+	flag.StringVar(&templates.Project, "project-template", templates.Project, "Output directory template for Claude projects")
+	flag.StringVar(&templates.Media, "media-template", templates.Media, "Output path template for placed media files")
+
+	flag.StringVar(&configFile, "config", "", "Config file with default settings and profiles (default: ./"+DefaultConfigFile+" if present)")
+	flag.StringVar(&profile, "profile", "", "Named profile from the config file to apply")
+	flag.BoolVar(&printConfig, "print-config", false, "Print the effective settings as JSON and exit")
+
+	flag.IntVar(&workers, "workers", parser.DefaultConversationWorkers, "Number of workers converting conversations in parallel")
+	flag.IntVar(&renderWorkers, "render-workers", renderer.DefaultWorkers, "Number of workers rendering markdown in parallel")
+
+	flag.StringVar(&logLevel, "log-level", "info", "Minimum level of log messages: debug, info, warn or error")
+	flag.StringVar(&logFormat, "log-format", utils.LogFormatText, "Log format: text or json (logs are written to stderr)")
 	
 	flag.Parse()
 
+	// Apply the config file; flags given on the command line take precedence
+	config, configSource, err := loadConfig(configFile)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if config != nil {
+		if err := applyConfig(config, profile); err != nil {
+			log.Fatalf("Invalid config file %s: %v", configSource, err)
+		}
+	} else if profile != "" {
+		log.Fatalf("--profile requires a config file (--config or ./%s)", DefaultConfigFile)
+	}
+
+	if err := utils.SetupLogging(os.Stderr, logLevel, logFormat); err != nil {
+		log.Fatalf("%v", err)
+	}
+
 	// Show version if requested
 	if showVersion {
 		fmt.Printf("Chat Export Transformer %s\n", Version)
@@ -72,19 +178,81 @@ func main() {
 		// Assume we're in the @wisdom folder
 		inputFolder = "./raw"
 	}
-	if outputFolder == "" {
+	if outputFolder == "" && archivePath == "" {
 		outputFolder = "./expanded"
 	}
 
+	// --copy-media is shorthand for --media-mode=copy
+	if copyMedia {
+		if mediaMode != "" && mediaMode != processor.MediaModeCopy {
+			log.Fatalf("Cannot combine --copy-media with --media-mode=%s", mediaMode)
+		}
+		mediaMode = processor.MediaModeCopy
+	}
+	if mediaMode == "" {
+		mediaMode = processor.MediaModeReference
+	}
+	if !utils.Contains(processor.ValidMediaModes, mediaMode) {
+		log.Fatalf("Invalid --media-mode %q (expected one of %s)", mediaMode, strings.Join(processor.ValidMediaModes, ", "))
+	}
+
+	if contentAddressed && mediaMode == processor.MediaModeReference {
+		log.Fatalf("--content-addressed requires --copy-media or a --media-mode other than reference")
+	}
+
+	if workers < 1 || renderWorkers < 1 {
+		log.Fatalf("--workers and --render-workers must be at least 1")
+	}
+
+	var sourceDate time.Time
+	if reproducible {
+		if sourceDate, err = utils.SourceDateEpoch(); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+
+	if printConfig {
+		if err := printEffectiveConfig(configSource, profile); err != nil {
+			log.Fatalf("%v", err)
+		}
+		return
+	}
+
 	// Convert to absolute paths
 	absInput, err := filepath.Abs(inputFolder)
 	if err != nil {
 		log.Fatalf("Failed to resolve input path: %v", err)
 	}
 
-	absOutput, err := filepath.Abs(outputFolder)
-	if err != nil {
-		log.Fatalf("Failed to resolve output path: %v", err)
+	if format != FormatExpanded {
+		if !utils.Contains(export.Formats, format) {
+			log.Fatalf("Invalid --format %q (expected %s or one of %s)", format, FormatExpanded, strings.Join(export.Formats, ", "))
+		}
+		if archivePath != "" || dryRun || planFile != "" {
+			log.Fatalf("--archive, --dry-run and --plan only apply to --format %s", FormatExpanded)
+		}
+	} else if outputFolder == export.Stdout {
+		log.Fatalf("Only exports can be written to stdout (see --format)")
+	}
+
+	// An export streamed to stdout keeps the console output on stderr
+	console := os.Stdout
+	if outputFolder == export.Stdout {
+		console = os.Stderr
+	}
+
+	var absOutput, absArchive string
+	if outputFolder == export.Stdout {
+		absOutput = export.Stdout
+	} else if outputFolder != "" {
+		if absOutput, err = filepath.Abs(outputFolder); err != nil {
+			log.Fatalf("Failed to resolve output path: %v", err)
+		}
+	}
+	if archivePath != "" {
+		if absArchive, err = filepath.Abs(archivePath); err != nil {
+			log.Fatalf("Failed to resolve archive path: %v", err)
+		}
 	}
 
 	// Verify input folder exists
@@ -92,9 +260,53 @@ func main() {
 		log.Fatalf("Input folder does not exist: %s", absInput)
 	}
 
+	if planFile != "" {
+		dryRun = true
+	}
+
+	// Build the conversation filter
+	var filter processor.Filter
+	if since != "" {
+		if filter.Since, err = processor.ParseFilterDate(since, false); err != nil {
+			log.Fatalf("Invalid --since: %v", err)
+		}
+	}
+	if until != "" {
+		if filter.Until, err = processor.ParseFilterDate(until, true); err != nil {
+			log.Fatalf("Invalid --until: %v", err)
+		}
+	}
+	if projects != "" {
+		filter.Projects = strings.Split(projects, ",")
+	}
+	if titleMatch != "" {
+		if filter.TitleMatch, err = regexp.Compile(titleMatch); err != nil {
+			log.Fatalf("Invalid --title-match: %v", err)
+		}
+	}
+	filter.MinMessages = minMessages
+	if idsFile != "" {
+		if filter.IDs, err = processor.LoadIDsFile(idsFile); err != nil {
+			log.Fatalf("Failed to read --ids-file: %v", err)
+		}
+	}
+
+	var rules []redact.Rule
+	if redactRules != "" {
+		if rules, err = redact.LoadRules(redactRules); err != nil {
+			log.Fatalf("Failed to read --redact-rules: %v", err)
+		}
+	}
+
+	if err := templates.Validate(); err != nil {
+		log.Fatalf("%v", err)
+	}
+
 	// Create output folder if it doesn't exist
-	if err := os.MkdirAll(absOutput, 0755); err != nil {
-		log.Fatalf("Failed to create output folder: %v", err)
+	if !dryRun && absOutput != "" && absOutput != export.Stdout {
+		if err := os.MkdirAll(absOutput, 0755); err != nil {
+			log.Fatalf("Failed to create output folder: %v", err)
+		}
 	}
 
 	// Determine what to process
@@ -105,23 +317,127 @@ func main() {
 		platformMode = "ChatGPT only"
 	}
 
-	fmt.Printf("Chat Export Transformer\n")
-	fmt.Printf("=======================\n")
-	fmt.Printf("Input folder:     %s\n", absInput)
-	fmt.Printf("Output folder:    %s\n", absOutput)
-	fmt.Printf("Copy media:       %v\n", copyMedia)
-	fmt.Printf("Platform mode:    %s\n", platformMode)
-	fmt.Printf("Render markdown:  %v\n", renderMarkdown)
-	fmt.Printf("\nStarting transformation...\n\n")
+	fmt.Fprintf(console, "Chat Export Transformer\n")
+	fmt.Fprintf(console, "=======================\n")
+	fmt.Fprintf(console, "Input folder:     %s\n", absInput)
+	if absOutput != "" {
+		fmt.Fprintf(console, "Output folder:    %s\n", absOutput)
+	}
+	if absArchive != "" {
+		fmt.Fprintf(console, "Archive:          %s\n", absArchive)
+	}
+	if format != FormatExpanded {
+		fmt.Fprintf(console, "Format:           %s\n", format)
+	}
+	fmt.Fprintf(console, "Media mode:       %s\n", mediaMode)
+	if contentAddressed {
+		fmt.Fprintf(console, "Media store:      content-addressed (SHA-256)\n")
+	}
+	fmt.Fprintf(console, "Platform mode:    %s\n", platformMode)
+	fmt.Fprintf(console, "Render markdown:  %v\n", renderMarkdown)
+	fmt.Fprintf(console, "Media gallery:    %v\n", gallery)
+	if !filter.IsEmpty() {
+		fmt.Fprintf(console, "Filters:          %s\n", filter)
+	}
+	if redactData || len(rules) > 0 {
+		fmt.Fprintf(console, "Redaction:        built-in rules + %d custom\n", len(rules))
+	}
+	if dryRun {
+		fmt.Fprintf(console, "\nPlanning transformation (dry run)...\n\n")
+	} else {
+		fmt.Fprintf(console, "\nStarting transformation...\n\n")
+	}
+
+	// The archive file is only created once a run succeeds, so dry runs leave no trace
+	var output sink.Sink
+	if absArchive != "" {
+		output = sink.New(absArchive)
+	}
+
+	var exporter export.Exporter
+	if format != FormatExpanded {
+		dest := export.Destination{Dir: absOutput, Gzip: gzipExport}
+		if exporter, err = newExporter(format, dest, ndjsonMessages, csvMaxContent, fineTune); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
 
 	// Initialize and run the processor
-	proc := processor.New(absInput, absOutput)
-	proc.SetCopyMedia(copyMedia)
-	proc.SetPlatformModes(claudeOnly, chatgptOnly)
-	proc.SetRenderMarkdown(renderMarkdown)
-	if err := proc.Run(); err != nil {
+	proc, err := processor.New(processor.Options{
+		InputPath:             absInput,
+		OutputPath:            absOutput,
+		Sink:                  output,
+		Exporter:              exporter,
+		MediaMode:             mediaMode,
+		ContentAddressedMedia: contentAddressed,
+		Gallery:               gallery,
+		ClaudeOnly:            claudeOnly,
+		ChatGPTOnly:           chatgptOnly,
+		RenderMarkdown:        renderMarkdown,
+		Filter:                filter,
+		Redact:                redactData,
+		RedactRules:           rules,
+		Templates:             templates,
+		FullRebuild:           fullRebuild,
+		Staging:               staging,
+		Resume:                resume,
+		Workers:               workers,
+		RenderWorkers:         renderWorkers,
+		Reproducible:          reproducible,
+		SourceDate:            sourceDate,
+		BuildInfo:             models.ToolInfo{Version: Version, Commit: GitCommit, BuildTime: BuildTime},
+	})
+	if err != nil {
+		if exporter != nil {
+			exporter.Close()
+		}
+		log.Fatalf("%v", err)
+	}
+
+	// Stop cleanly on Ctrl-C or SIGTERM; a second signal terminates immediately
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if dryRun {
+		plan, err := proc.Plan(ctx)
+		if err != nil {
+			log.Fatalf("Planning failed: %v", err)
+		}
+		processor.PrintPlan(plan)
+		if planFile != "" {
+			if err := processor.SavePlan(plan, planFile); err != nil {
+				log.Fatalf("Failed to write plan: %v", err)
+			}
+			fmt.Printf("Plan written to %s\n", planFile)
+		}
+		return
+	}
+
+	if err := proc.Run(ctx); err != nil {
 		log.Fatalf("Transformation failed: %v", err)
 	}
 
-	fmt.Println("\nTransformation completed successfully!")
-}
\ No newline at end of file
+	fmt.Fprintln(console, "\nTransformation completed successfully!")
+}
+
+// FormatExpanded is the default output format: folders of conversation files,
+// indexes and media
+const FormatExpanded = "expanded"
+
+// newExporter creates the exporter for an export format
+func newExporter(format string, dest export.Destination, ndjsonMessages bool, csvMaxContent int, fineTune export.FineTuneOptions) (export.Exporter, error) {
+	switch format {
+	case export.FormatNDJSON:
+		return export.NDJSONFiles(dest, ndjsonMessages)
+	case export.FormatCSV:
+		return export.CSVFiles(dest, csvMaxContent)
+	case export.FormatOpenAI, export.FormatAnthropic:
+		return export.FineTuneFiles(dest, format, fineTune)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
@@ -0,0 +1,170 @@
+package transformer
+
+import (
+	"context"
+	"io/fs"
+	"log/slog"
+
+	"github.com/oisee/chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/parser"
+	"github.com/oisee/chat-transformer/internal/redact"
+)
+
+// Platforms supported by the adapters
+const (
+	PlatformClaude  = "claude"
+	PlatformChatGPT = "chatgpt"
+)
+
+// Adapter reads one platform's export and converts its conversations to the
+// normalized model
+type Adapter interface {
+	// Platform names the platform, e.g. "claude"
+	Platform() string
+
+	// Conversations passes every conversation of the export to fn, one at a time
+	// and in export order. It stops at the first error returned by fn, or when
+	// ctx is cancelled, and returns that error.
+	Conversations(ctx context.Context, fn func(Conversation) error) error
+}
+
+// NewClaudeAdapter returns an adapter for the Claude export in fsys, which holds
+// the claude-* export folder. Workers sets how many conversations are converted
+// at once; zero keeps the default.
+func NewClaudeAdapter(fsys fs.FS, workers int) Adapter {
+	return newClaudeAdapter(parser.Input{FS: fsys}, workers, slog.Default())
+}
+
+func newClaudeAdapter(input parser.Input, workers int, logger *slog.Logger) Adapter {
+	p := parser.NewClaudeParser(input)
+	p.SetWorkers(workers)
+	p.SetLogger(logger)
+	return &claudeAdapter{parser: p, logger: logger}
+}
+
+// NewChatGPTAdapter returns an adapter for the ChatGPT export in fsys, which
+// holds the chat-gpt-* export folder. Workers sets how many conversations are
+// converted at once; zero keeps the default.
+func NewChatGPTAdapter(fsys fs.FS, workers int) Adapter {
+	return newChatGPTAdapter(parser.Input{FS: fsys}, workers, slog.Default())
+}
+
+func newChatGPTAdapter(input parser.Input, workers int, logger *slog.Logger) Adapter {
+	p := parser.NewChatGPTParser(input)
+	p.SetWorkers(workers)
+	p.SetLogger(logger)
+	return &chatgptAdapter{parser: p}
+}
+
+// Adapters returns the adapters for the input and platforms selected by opts,
+// logging to opts.Logger
+func Adapters(opts Options) []Adapter {
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	input := parser.DirInput(opts.InputPath)
+	if opts.InputFS != nil {
+		input = parser.Input{FS: opts.InputFS}
+	}
+
+	var adapters []Adapter
+	if !opts.ChatGPTOnly {
+		adapters = append(adapters, newClaudeAdapter(input, opts.Workers, logger))
+	}
+	if !opts.ClaudeOnly {
+		adapters = append(adapters, newChatGPTAdapter(input, opts.Workers, logger))
+	}
+	return adapters
+}
+
+// Stream passes the conversations of the exports in opts.InputPath that match
+// opts.Filter to fn, Claude conversations first, without writing anything.
+// They are redacted as in Transform when opts.Redact or opts.RedactRules is
+// set; other output options are ignored. It stops at the first error returned by fn.
+func Stream(ctx context.Context, opts Options, fn func(Conversation) error) error {
+	var redactor *redact.Redactor
+	if opts.Redact || len(opts.RedactRules) > 0 {
+		redactor = redact.New(append(redact.BuiltinRules(), opts.processorOptions().RedactRules...))
+	}
+
+	for _, adapter := range Adapters(opts) {
+		err := adapter.Conversations(ctx, func(conv Conversation) error {
+			if !opts.Filter.Matches(conv) {
+				return nil
+			}
+			if redactor != nil {
+				redactor.Redact(&conv)
+			}
+			return fn(conv)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type claudeAdapter struct {
+	parser *parser.ClaudeParser
+	logger *slog.Logger
+}
+
+func (a *claudeAdapter) Platform() string {
+	return PlatformClaude
+}
+
+func (a *claudeAdapter) Conversations(ctx context.Context, fn func(Conversation) error) error {
+	projects, err := a.parser.ParseProjects()
+	if err != nil {
+		a.logger.Warn("failed to load Claude projects", "error", err)
+	}
+	projectMap := make(map[string]models.ClaudeProject)
+	for _, project := range projects {
+		projectMap[project.UUID] = project
+	}
+
+	return stopOnError(ctx, func(ctx context.Context, deliver func(Conversation) error) error {
+		return a.parser.ParseConversations(ctx, projectMap, func(_ models.ClaudeConversation, conv models.Conversation) error {
+			return deliver(conv)
+		})
+	}, fn)
+}
+
+type chatgptAdapter struct {
+	parser *parser.ChatGPTParser
+}
+
+func (a *chatgptAdapter) Platform() string {
+	return PlatformChatGPT
+}
+
+func (a *chatgptAdapter) Conversations(ctx context.Context, fn func(Conversation) error) error {
+	return stopOnError(ctx, func(ctx context.Context, deliver func(Conversation) error) error {
+		return a.parser.ParseConversations(ctx, func(_ models.ChatGPTConversation, conv models.Conversation) error {
+			return deliver(conv)
+		})
+	}, fn)
+}
+
+// stopOnError runs parse with a context that is cancelled as soon as fn fails,
+// so the parsers, which report failed conversations and carry on, stop at the
+// first error and return it
+func stopOnError(ctx context.Context, parse func(context.Context, func(Conversation) error) error, fn func(Conversation) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var fnErr error
+	err := parse(ctx, func(conv Conversation) error {
+		if err := fn(conv); err != nil {
+			fnErr = err
+			cancel()
+		}
+		return nil
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	return err
+}
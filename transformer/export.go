@@ -0,0 +1,61 @@
+package transformer
+
+import (
+	"io"
+	"log/slog"
+
+	"github.com/oisee/chat-transformer/internal/export"
+)
+
+// Exporter receives the selected conversations of a run in a single-stream
+// format instead of the expanded output; set it in Options.Exporter
+type Exporter interface {
+	// Write adds a conversation
+	Write(conv Conversation) error
+
+	// Commit completes the output
+	Commit() error
+
+	// Close releases the output, discarding it unless it was committed. It is
+	// safe to defer.
+	Close() error
+}
+
+// MessageRecord is a message written on its own line by an NDJSON exporter
+type MessageRecord = export.MessageRecord
+
+// NewNDJSONExporter returns an exporter that writes a conversation per line to
+// conversations. When messages is not nil, conversation lines hold only the
+// metadata and every message is written to messages as a MessageRecord.
+func NewNDJSONExporter(conversations, messages io.Writer) Exporter {
+	return export.NewNDJSON(conversations, messages)
+}
+
+// NewCSVExporter returns an exporter that writes a conversations table and a
+// messages table as RFC 4180 CSV. Message content longer than maxContent
+// characters is cut off when maxContent is positive.
+func NewCSVExporter(conversations, messages io.Writer, maxContent int) Exporter {
+	return export.NewCSV(conversations, messages, maxContent)
+}
+
+// FineTuneOptions select the turns of fine-tuning examples
+type FineTuneOptions struct {
+	KeepSystem    bool // keep system turns; dropped by default
+	KeepTool      bool // keep tool output; dropped by default
+	MaxTurns      int  // most user, assistant and tool turns per example; 0 for no limit
+	MaxCharacters int  // most characters per example, system turns included; 0 for no limit
+
+	Logger *slog.Logger // receives the summary logged by Commit; nil uses slog.Default()
+}
+
+// Fine-tuning formats accepted by NewFineTuneExporter
+const (
+	FineTuneOpenAI    = export.FormatOpenAI
+	FineTuneAnthropic = export.FormatAnthropic
+)
+
+// NewFineTuneExporter returns an exporter that writes a fine-tuning example per
+// conversation to w, in the OpenAI chat format or the Anthropic Messages format
+func NewFineTuneExporter(w io.Writer, format string, options FineTuneOptions) (Exporter, error) {
+	return export.NewFineTune(w, format, export.FineTuneOptions(options))
+}
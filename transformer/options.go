@@ -0,0 +1,170 @@
+package transformer
+
+import (
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/oisee/chat-transformer/internal/processor"
+	"github.com/oisee/chat-transformer/internal/redact"
+)
+
+// Options configure a run. The zero value of a field selects its default, so
+// only an input and an output are required.
+type Options struct {
+	InputPath  string // directory holding the claude-* and chat-gpt-* export folders
+	InputFS    fs.FS  // the same folders from any file system; used instead of InputPath when set
+	OutputPath string // directory the expanded output is written to
+	Sink       Sink   // receives the finished output; with no OutputPath the run is built in memory
+
+	// Exporter receives the selected conversations instead of the expanded output.
+	// Media, markdown and output layout options do not apply to exports.
+	Exporter Exporter
+
+	MediaMode             string // MediaModeReference (default), MediaModeCopy, MediaModeHardlink or MediaModeSymlink
+	ContentAddressedMedia bool   // store placed media by SHA-256; requires a media mode other than reference
+	Gallery               bool   // create image thumbnails and the HTML media gallery
+
+	ClaudeOnly     bool // process only Claude conversations
+	ChatGPTOnly    bool // process only ChatGPT conversations
+	RenderMarkdown bool // render conversations and projects to markdown
+	Filter         Filter
+
+	Redact      bool            // replace personal data and secrets with placeholders before conversations are written
+	RedactRules []RedactionRule // applied after the built-in rules; implies Redact
+	Templates   PathTemplates   // empty templates use DefaultPathTemplates
+
+	FullRebuild bool // ignore the manifest and rewrite every conversation
+	Staging     bool // build the run next to the output directory and swap it into place on success
+	Resume      bool // continue an interrupted run from its checkpoint
+
+	Workers       int // workers converting conversations (0 for the default)
+	RenderWorkers int // workers rendering markdown (0 for the default)
+
+	Reproducible bool      // record SourceDate instead of the current time in generated files
+	SourceDate   time.Time // default: the Unix epoch
+
+	BuildInfo ToolInfo // recorded in the transformation report
+
+	// Logger receives the run's log messages (default slog.Default()). Warnings
+	// logged during a run are also collected for the transformation report.
+	Logger *slog.Logger
+}
+
+// Validate checks that the options describe a run that can be carried out
+func (o Options) Validate() error {
+	return o.processorOptions().Validate()
+}
+
+// processorOptions converts the options to those of the processor
+func (o Options) processorOptions() processor.Options {
+	rules := make([]redact.Rule, len(o.RedactRules))
+	for i, rule := range o.RedactRules {
+		rules[i] = redact.Rule(rule)
+	}
+
+	return processor.Options{
+		InputPath:             o.InputPath,
+		InputFS:               o.InputFS,
+		OutputPath:            o.OutputPath,
+		Sink:                  o.Sink,
+		Exporter:              o.Exporter,
+		MediaMode:             o.MediaMode,
+		ContentAddressedMedia: o.ContentAddressedMedia,
+		Gallery:               o.Gallery,
+		ClaudeOnly:            o.ClaudeOnly,
+		ChatGPTOnly:           o.ChatGPTOnly,
+		RenderMarkdown:        o.RenderMarkdown,
+		Filter:                processor.Filter(o.Filter),
+		Redact:                o.Redact,
+		RedactRules:           rules,
+		Templates:             processor.PathTemplates(o.Templates),
+		FullRebuild:           o.FullRebuild,
+		Staging:               o.Staging,
+		Resume:                o.Resume,
+		Workers:               o.Workers,
+		RenderWorkers:         o.RenderWorkers,
+		Reproducible:          o.Reproducible,
+		SourceDate:            o.SourceDate,
+		BuildInfo:             o.BuildInfo,
+		Logger:                o.Logger,
+	}
+}
+
+// Filter selects which conversations a run processes. The zero value selects everything.
+type Filter struct {
+	Since       time.Time       // keep conversations created at or after Since
+	Until       time.Time       // keep conversations created at or before Until
+	Projects    []string        // keep conversations in one of these projects (case-insensitive)
+	TitleMatch  *regexp.Regexp  // keep conversations whose title matches
+	MinMessages int             // keep conversations with at least this many messages
+	IDs         map[string]bool // keep the conversations with these IDs
+}
+
+// IsEmpty reports whether the filter selects every conversation
+func (f Filter) IsEmpty() bool {
+	return processor.Filter(f).IsEmpty()
+}
+
+// Matches reports whether a conversation is selected by the filter
+func (f Filter) Matches(conv Conversation) bool {
+	return processor.Filter(f).Matches(conv)
+}
+
+// MatchesProject reports whether a project is selected by the filter
+func (f Filter) MatchesProject(project string) bool {
+	return processor.Filter(f).MatchesProject(project)
+}
+
+// String describes the active filter criteria
+func (f Filter) String() string {
+	return processor.Filter(f).String()
+}
+
+// PathTemplates control where conversations, projects and media are written,
+// relative to the output directory. Placeholders are written as {name}, or as
+// {name|"fallback"} to use fallback when the value is empty.
+//
+// Conversations: {platform} {project} {yyyy} {mm} {dd} {date} {slug} {id} {id8}
+// Projects:      {platform} {project} {id} {id8}
+// Media:         {platform} {folder} {name}
+type PathTemplates struct {
+	Conversation        string // conversations outside a project
+	ProjectConversation string // conversations that belong to a project
+	Project             string // project directory holding project.json and documents/
+	Media               string // copied media files
+}
+
+// DefaultPathTemplates returns the standard output layout
+func DefaultPathTemplates() PathTemplates {
+	return PathTemplates(processor.DefaultPathTemplates())
+}
+
+// Validate checks that every template only uses known placeholders, stays inside
+// the output directory and includes the placeholders that keep paths unique
+func (t PathTemplates) Validate() error {
+	return processor.PathTemplates(t).Validate()
+}
+
+// RedactionRule finds values to redact; see Options.RedactRules
+type RedactionRule struct {
+	Name    string                  // names the placeholders, e.g. email for [EMAIL_1]
+	Pattern *regexp.Regexp          // when it has a capture group, only the first group is replaced
+	Valid   func(value string) bool // optional check that a match really is such a value
+}
+
+// LoadRedactionRules reads redaction rules from a file with one rule per line: a
+// name, whitespace and a regular expression
+func LoadRedactionRules(path string) ([]RedactionRule, error) {
+	rules, err := redact.LoadRules(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]RedactionRule, len(rules))
+	for i, rule := range rules {
+		result[i] = RedactionRule(rule)
+	}
+	return result, nil
+}
@@ -0,0 +1,42 @@
+package transformer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/oisee/chat-transformer/internal/processor"
+)
+
+// The public options mirror the processor's field for field, so none is lost at the boundary
+func TestOptionsMirrorProcessorOptions(t *testing.T) {
+	public := reflect.TypeOf(Options{})
+	internal := reflect.TypeOf(processor.Options{})
+	if public.NumField() != internal.NumField() {
+		t.Fatalf("Options has %d fields, processor.Options has %d", public.NumField(), internal.NumField())
+	}
+	for i := 0; i < public.NumField(); i++ {
+		if public.Field(i).Name != internal.Field(i).Name {
+			t.Errorf("field %d is %s, processor.Options has %s", i, public.Field(i).Name, internal.Field(i).Name)
+		}
+	}
+
+	// A field left out of processorOptions would come back empty
+	opts := Options{
+		InputPath:     "raw",
+		OutputPath:    "out",
+		MediaMode:     MediaModeCopy,
+		Filter:        Filter{Projects: []string{"Go Tooling"}},
+		RedactRules:   []RedactionRule{{Name: "host"}},
+		Templates:     DefaultPathTemplates(),
+		Workers:       2,
+		RenderWorkers: 3,
+		BuildInfo:     ToolInfo{Version: "v1"},
+	}
+	converted := reflect.ValueOf(opts.processorOptions())
+	original := reflect.ValueOf(opts)
+	for i := 0; i < original.NumField(); i++ {
+		if !original.Field(i).IsZero() && converted.Field(i).IsZero() {
+			t.Errorf("%s is not converted", public.Field(i).Name)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package transformer
+
+import (
+	"io"
+	"time"
+
+	"github.com/oisee/chat-transformer/internal/sink"
+)
+
+// Sink receives the files of a finished run; set it in Options.Sink. Without an
+// OutputPath the run is built in memory.
+type Sink interface {
+	// WriteFile adds a file of size bytes read from r. Name is slash-separated
+	// and relative to the root of the output.
+	WriteFile(name string, size int64, modTime time.Time, r io.Reader) error
+
+	// Close finishes the output. Sinks returned by NewTarGzSink and NewZipSink do
+	// not close the writer they were created with.
+	Close() error
+}
+
+// NewSink returns the sink for path, chosen by its extension: .tar.gz or .tgz for
+// a tar.gz archive, .zip for a zip archive and a directory otherwise
+func NewSink(path string) Sink {
+	return sink.New(path)
+}
+
+// NewDirectorySink returns a sink that writes files below root
+func NewDirectorySink(root string) Sink {
+	return sink.NewDirectory(root)
+}
+
+// NewTarGzSink returns a sink that writes a tar.gz archive to w, which it does not close
+func NewTarGzSink(w io.Writer) Sink {
+	return sink.NewTarGz(w)
+}
+
+// NewZipSink returns a sink that writes a zip archive to w, which it does not close
+func NewZipSink(w io.Writer) Sink {
+	return sink.NewZip(w)
+}
@@ -0,0 +1,57 @@
+// Package transformer exposes the chat export transformer to other Go programs:
+// the normalized conversation model, adapters that read Claude and ChatGPT
+// exports into it, and Transform, which writes the expanded output like the
+// chat-transformer command does.
+//
+// Conversations can also be consumed in process without writing any files:
+//
+//	err := transformer.Stream(ctx, transformer.Options{InputPath: "raw"}, func(conv transformer.Conversation) error {
+//		fmt.Println(conv.Metadata.Title)
+//		return nil
+//	})
+package transformer
+
+import (
+	"context"
+
+	"github.com/oisee/chat-transformer/internal/models"
+	"github.com/oisee/chat-transformer/internal/processor"
+)
+
+// Normalized model shared by all platforms
+type (
+	Conversation         = models.Conversation
+	ConversationMetadata = models.ConversationMetadata
+	Message              = models.Message
+	AudioClip            = models.AudioClip
+)
+
+// Run results
+type (
+	ToolInfo = models.ToolInfo
+	Report   = models.TransformationReport
+)
+
+// Media modes accepted in Options.MediaMode
+const (
+	MediaModeReference = processor.MediaModeReference
+	MediaModeCopy      = processor.MediaModeCopy
+	MediaModeHardlink  = processor.MediaModeHardlink
+	MediaModeSymlink   = processor.MediaModeSymlink
+)
+
+// Transform converts the exports in opts.InputPath (or opts.InputFS) and writes
+// the expanded output to opts.OutputPath and opts.Sink, returning the
+// transformation report. With opts.Exporter set, the conversations are exported
+// instead and no report is returned. When ctx is cancelled, the work in flight
+// is finished, a checkpoint is saved and the context's error is returned.
+func Transform(ctx context.Context, opts Options) (*Report, error) {
+	proc, err := processor.New(opts.processorOptions())
+	if err != nil {
+		return nil, err
+	}
+	if err := proc.Run(ctx); err != nil {
+		return nil, err
+	}
+	return proc.Report(), nil
+}